@@ -25,9 +25,8 @@ func main() {
 		Build()
 
 	// enqueue the task
-	ok := p.Enqueue(t)
-	if !ok {
-		log.Fatal("queue is full")
+	if err := p.Enqueue(t); err != nil {
+		log.Fatal(err)
 	}
 
 	m := t.Metadata()
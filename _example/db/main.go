@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 	"sync"
-	"time"
 
 	"github.com/svaloumas/iocast"
 )
@@ -13,7 +12,6 @@ func main() {
 	// create the worker pool
 	p := iocast.NewWorkerPool(4, 8)
 	p.Start(context.Background())
-	defer p.Stop()
 
 	// create a task func
 	args := &Args{addr: "http://somewhere.net", id: 1}
@@ -25,17 +23,17 @@ func main() {
 	t := iocast.TaskBuilder("uuid", taskFn).Database(db).Build()
 
 	// enqueue the task
-	ok := p.Enqueue(t)
-	if !ok {
-		log.Fatal("queue is full")
+	if err := p.Enqueue(t); err != nil {
+		log.Fatal(err)
 	}
 
-	// wait for the result
-	time.Sleep(500 * time.Millisecond)
-	data, ok := m.Load("uuid")
-	if !ok {
-		log.Fatal("result not written")
+	// stop the pool, which waits for the result to be written
+	p.Stop()
+
+	// read it back from the database
+	result, err := iocast.ReadResult[string](db, "uuid")
+	if err != nil {
+		log.Fatal(err)
 	}
-	bytes := data.([]byte)
-	log.Printf("result: %+v\n", string(bytes))
+	log.Printf("result: %+v\n", result)
 }
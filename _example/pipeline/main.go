@@ -35,9 +35,8 @@ func main() {
 	}
 
 	// enqueue the pipeline
-	ok := q.Enqueue(p)
-	if !ok {
-		log.Fatal("queue is full")
+	if err := q.Enqueue(p); err != nil {
+		log.Fatal(err)
 	}
 
 	// wait for the result
@@ -22,7 +22,7 @@ func main() {
 	t := iocast.TaskBuilder("uuid", taskFn).Build()
 
 	// create the scheduler
-	s := iocast.NewScheduler(p, 100*time.Millisecond)
+	s := iocast.NewScheduler(p, iocast.NewScheduleMemDB(), 100*time.Millisecond)
 	defer s.Stop()
 
 	// run it
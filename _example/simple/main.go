@@ -21,9 +21,8 @@ func main() {
 	t := iocast.TaskBuilder("uuid", taskFn).MaxRetries(3).Build()
 
 	// enqueue the task
-	ok := p.Enqueue(t)
-	if !ok {
-		log.Fatal("queue is full")
+	if err := p.Enqueue(t); err != nil {
+		log.Fatal(err)
 	}
 
 	m := t.Metadata()
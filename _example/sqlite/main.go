@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/svaloumas/iocast"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	// open the database with any database/sql driver, here a pure-Go SQLite one
+	conn, err := sql.Open("sqlite", "file:results.db")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	// SQLite allows a single writer at a time
+	conn.SetMaxOpenConns(1)
+
+	// create the results table if it does not exist
+	db, err := iocast.NewSQLDB(conn, iocast.DialectSQLite, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create the worker pool
+	p := iocast.NewWorkerPool(4, 8)
+	p.Start(context.Background())
+
+	// create a task that stores its result in the database
+	taskFn := iocast.NewTaskFunc(context.Background(), "nightly", GenerateReport)
+	t := iocast.TaskBuilder("report", taskFn).Tags("reports").Database(db).Build()
+
+	// enqueue the task
+	if err := p.Enqueue(t); err != nil {
+		log.Fatal(err)
+	}
+
+	// stop the pool, which waits for the result to be written
+	p.Stop()
+
+	// query the stored results
+	records, err := iocast.ListResults[string](db, iocast.Filter{
+		Status: iocast.TaskStatusSuccess,
+		Tag:    "reports",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, rec := range records {
+		log.Printf("%s: %+v\n", rec.ID, rec.Result)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+func GenerateReport(ctx context.Context, name string) (string, error) {
+	select {
+	case <-time.After(100 * time.Millisecond):
+		return "path/to/" + name + ".pdf", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
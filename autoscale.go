@@ -0,0 +1,86 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	defaultAutoscaleInterval = time.Second
+)
+
+// AutoscaleOptions configures the autoscaler of a worker pool.
+type AutoscaleOptions struct {
+	// Min and Max bound the number of workers.
+	Min int
+	Max int
+	// Interval is how often the pool is resized, it defaults to one second.
+	Interval time.Duration
+	// MaxQueueWait is the average time jobs may wait in the queue before the pool grows
+	// even if it has as many workers as jobs. Zero only scales on the queue depth.
+	MaxQueueWait time.Duration
+}
+
+// Autoscale resizes the worker pool between opts.Min and opts.Max workers until the
+// context is done or the pool is stopped. Every interval, the pool grows at once to as
+// many workers as running and queued jobs, or by one more worker if jobs waited longer
+// than opts.MaxQueueWait on average, and shrinks by one worker at a time when it has more
+// than it needs, so that short lulls do not drop the workers a burst will need again.
+func (p *WorkerPool) Autoscale(ctx context.Context, opts AutoscaleOptions) error {
+	if opts.Min < 0 || opts.Max < 1 || opts.Max < opts.Min {
+		return fmt.Errorf("%w: min %d, max %d", ErrInvalidPoolSize, opts.Min, opts.Max)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultAutoscaleInterval
+	}
+	go func() {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.Resize(p.desiredSize(opts)); err != nil {
+					if !errors.Is(err, ErrPoolStopped) {
+						log.Printf("error autoscaling the worker pool: %v", err)
+					}
+					return
+				}
+			case <-p.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// desiredSize returns the number of workers the pool should have, given the jobs it ran since the last call.
+func (p *WorkerPool) desiredSize(opts AutoscaleOptions) int {
+	size := p.Size()
+	// Jobs held back by the queue, e.g. in paused router queues, need no workers yet.
+	depth := p.queue.Len()
+	if r, ok := p.queue.(runnableLener); ok {
+		depth = r.runnableLen()
+	}
+	needed := int(p.busy.Load()) + depth
+
+	var wait time.Duration
+	if n := p.waitCount.Swap(0); n > 0 {
+		wait = time.Duration(p.waitSum.Swap(0) / n)
+	}
+
+	desired := size
+	switch {
+	case needed > size:
+		desired = needed
+	case opts.MaxQueueWait > 0 && wait > opts.MaxQueueWait && depth > 0:
+		desired = size + 1
+	case needed < size:
+		desired = size - 1
+	}
+	return min(max(desired, opts.Min), opts.Max)
+}
@@ -0,0 +1,116 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAutoscaleInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts AutoscaleOptions
+	}{
+		{"negative min", AutoscaleOptions{Min: -1, Max: 2}},
+		{"zero max", AutoscaleOptions{}},
+		{"max below min", AutoscaleOptions{Min: 3, Max: 2}},
+	}
+
+	p := NewWorkerPool(1, 1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Autoscale(context.Background(), tt.opts)
+			if !errors.Is(err, ErrInvalidPoolSize) {
+				t.Errorf("unexpected error: got %v want %v", err, ErrInvalidPoolSize)
+			}
+		})
+	}
+}
+
+func TestAutoscale(t *testing.T) {
+	p := NewWorkerPool(1, 8)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := p.Autoscale(ctx, AutoscaleOptions{Min: 1, Max: 4, Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitSize := func(expected int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for p.Size() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("unexpected size: got %v want %v", p.Size(), expected)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	release := make(chan struct{})
+	blocking := func(_ context.Context, args string) (string, error) {
+		<-release
+		return args, nil
+	}
+	// a burst of six jobs grows the pool up to its max
+	var tasks []*Task[string]
+	for _, id := range []string{"1", "2", "3", "4", "5", "6"} {
+		task := TaskBuilder(id, NewTaskFunc(context.Background(), id, blocking)).Build()
+		if err := p.Enqueue(task); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+	waitSize(4)
+
+	// once the burst is over, the pool shrinks back to its min
+	close(release)
+	for _, task := range tasks {
+		<-task.Wait()
+	}
+	waitSize(1)
+}
+
+func TestAutoscaleWithRouter(t *testing.T) {
+	r := NewRouter(RoundRobin)
+	r.AddQueue("paused", QueueOptions{Capacity: 8})
+	r.AddQueue("limited", QueueOptions{Workers: 1, Capacity: 8})
+	if err := r.Pause("paused"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := NewWorkerPoolWithQueue(1, r)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	release := make(chan struct{})
+	defer close(release)
+	blocking := func(_ context.Context, args string) (string, error) {
+		<-release
+		return args, nil
+	}
+	for _, queue := range []string{"paused", "limited"} {
+		for _, id := range []string{"1", "2", "3", "4"} {
+			task := TaskBuilder(queue+id, NewTaskFunc(context.Background(), id, blocking)).Queue(queue).Build()
+			if err := p.Enqueue(task); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := p.Autoscale(ctx, AutoscaleOptions{Min: 1, Max: 4, Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the jobs of the paused queue and those past the workers limit don't grow the pool
+	time.Sleep(50 * time.Millisecond)
+	if size := p.Size(); size != 1 {
+		t.Errorf("unexpected size: got %v want %v", size, 1)
+	}
+}
@@ -5,23 +5,31 @@ import (
 )
 
 type taskBuilder[T any] struct {
-	id         string
-	taskFn     TaskFn[T]
-	resultChan chan Result[T]
-	next       *Task[T]
-	maxRetries int
-	backoff    []time.Duration
-	db         DB
-	metadata   Metadata
+	id          string
+	taskFn      TaskFn[T]
+	next        *Task[T]
+	maxRetries  int
+	retryPolicy RetryPolicy
+	retryIf     func(error) bool
+	permPanics  bool
+	retriesSet  bool
+	policySet   bool
+	timeout     time.Duration
+	deadline    time.Time
+	db          DB
+	metadata    Metadata
+	envelope    *TaskEnvelope
+	hooks       taskHooks[T]
+	middleware  []Middleware
 }
 
 // TaskBuilder creates and returns a new TaskBuilder instance.
 func TaskBuilder[T any](id string, fn TaskFn[T]) *taskBuilder[T] {
 	t := &taskBuilder[T]{
-		id:         id,
-		taskFn:     fn,
-		resultChan: make(chan Result[T], 1),
-		maxRetries: 1,
+		id:          id,
+		taskFn:      fn,
+		maxRetries:  1,
+		retryPolicy: ConstantBackOff(0),
 		metadata: Metadata{
 			CreatetAt: time.Now().UTC(),
 			Status:    TaskStatusPending,
@@ -36,16 +44,110 @@ func (b *taskBuilder[T]) MaxRetries(maxRetries int) *taskBuilder[T] {
 		maxRetries = 1
 	}
 	b.maxRetries = maxRetries
+	b.retriesSet = true
 	return b
 }
 
 // BackOff passes backoff intervals between retires to the task builder.
+// Retries beyond the last interval wait for the last one.
 func (b *taskBuilder[T]) BackOff(backoff []time.Duration) *taskBuilder[T] {
-	if len(backoff) > b.maxRetries {
-		b.backoff = backoff[:b.maxRetries]
-	} else if len(backoff) == b.maxRetries {
-		b.backoff = backoff
-	}
+	b.retryPolicy = Intervals(backoff)
+	b.policySet = true
+	return b
+}
+
+// RetryPolicy passes a policy deciding when failed attempts are retried to the task builder.
+// Retries are still bounded by MaxRetries.
+func (b *taskBuilder[T]) RetryPolicy(p RetryPolicy) *taskBuilder[T] {
+	b.retryPolicy = p
+	b.policySet = true
+	return b
+}
+
+// RetryIf passes a predicate deciding which errors are retried to the task builder.
+// Errors wrapped with Permanent are never retried.
+func (b *taskBuilder[T]) RetryIf(retryIf func(error) bool) *taskBuilder[T] {
+	b.retryIf = retryIf
+	return b
+}
+
+// PermanentPanics makes the task fail without any further retries when an attempt panics.
+// By default, panics are retried like any other error.
+func (b *taskBuilder[T]) PermanentPanics() *taskBuilder[T] {
+	b.permPanics = true
+	return b
+}
+
+// Timeout passes the maximum duration of every attempt to the task builder. An attempt that
+// runs past it fails right away, but the next attempt only starts once its task func has
+// returned, so task funcs should give up when their context is done.
+func (b *taskBuilder[T]) Timeout(timeout time.Duration) *taskBuilder[T] {
+	b.timeout = timeout
+	b.metadata.Timeout = timeout
+	return b
+}
+
+// Deadline passes the time by which the task must have finished, including its retries, to the task builder.
+func (b *taskBuilder[T]) Deadline(deadline time.Time) *taskBuilder[T] {
+	b.deadline = deadline
+	b.metadata.Deadline = deadline
+	return b
+}
+
+// Tags passes tags to the task builder, they are stored with the task's metadata and can be used to filter results.
+func (b *taskBuilder[T]) Tags(tags ...string) *taskBuilder[T] {
+	b.metadata.Tags = append(b.metadata.Tags, tags...)
+	return b
+}
+
+// Priority passes a priority to the task builder. Jobs of higher priority are dequeued
+// first by the queues that support priorities, the default priority is zero.
+func (b *taskBuilder[T]) Priority(priority int) *taskBuilder[T] {
+	b.metadata.Priority = priority
+	return b
+}
+
+// Queue passes the name of the router queue the task is enqueued to to the task builder.
+// Tasks without a queue are routed to DefaultQueue.
+func (b *taskBuilder[T]) Queue(name string) *taskBuilder[T] {
+	b.metadata.Queue = name
+	return b
+}
+
+// OnStart passes a hook that runs when the task starts executing to the task builder.
+func (b *taskBuilder[T]) OnStart(fn func(Metadata)) *taskBuilder[T] {
+	b.hooks.onStart = append(b.hooks.onStart, fn)
+	return b
+}
+
+// OnRetry passes a hook that runs with the number and the error of a failed attempt before it is retried to the task builder.
+func (b *taskBuilder[T]) OnRetry(fn func(attempt int, err error)) *taskBuilder[T] {
+	b.hooks.onRetry = append(b.hooks.onRetry, fn)
+	return b
+}
+
+// OnSuccess passes a hook that runs when the task succeeds to the task builder.
+// The completion hooks of the head of a pipeline observe the result of the whole pipeline.
+func (b *taskBuilder[T]) OnSuccess(fn func(Result[T])) *taskBuilder[T] {
+	b.hooks.onSuccess = append(b.hooks.onSuccess, fn)
+	return b
+}
+
+// OnFailure passes a hook that runs when the task fails, times out or is cancelled to the task builder.
+func (b *taskBuilder[T]) OnFailure(fn func(Result[T])) *taskBuilder[T] {
+	b.hooks.onFailure = append(b.hooks.onFailure, fn)
+	return b
+}
+
+// OnComplete passes a hook that runs when the task finishes, whatever its outcome, to the task builder.
+func (b *taskBuilder[T]) OnComplete(fn func(Result[T])) *taskBuilder[T] {
+	b.hooks.onComplete = append(b.hooks.onComplete, fn)
+	return b
+}
+
+// Use passes middleware wrapping every attempt of the task to the task builder.
+func (b *taskBuilder[T]) Use(middleware ...Middleware) *taskBuilder[T] {
+	b.middleware = append(b.middleware, middleware...)
 	return b
 }
 
@@ -58,13 +160,22 @@ func (b *taskBuilder[T]) Database(db DB) *taskBuilder[T] {
 // Build initializes and returns a new task instance.
 func (b *taskBuilder[T]) Build() *Task[T] {
 	return &Task[T]{
-		id:         b.id,
-		taskFn:     b.taskFn,
-		resultChan: b.resultChan,
-		maxRetries: b.maxRetries,
-		backoff:    b.backoff,
-		next:       b.next,
-		db:         b.db,
-		metadata:   b.metadata,
+		id:          b.id,
+		taskFn:      b.taskFn,
+		result:      newFuture[T](),
+		maxRetries:  b.maxRetries,
+		retryPolicy: b.retryPolicy,
+		retryIf:     b.retryIf,
+		permPanics:  b.permPanics,
+		retriesSet:  b.retriesSet,
+		policySet:   b.policySet,
+		timeout:     b.timeout,
+		deadline:    b.deadline,
+		next:        b.next,
+		db:          b.db,
+		metadata:    b.metadata,
+		envelope:    b.envelope,
+		hooks:       b.hooks,
+		middleware:  b.middleware,
 	}
 }
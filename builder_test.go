@@ -20,16 +20,20 @@ func TestTaskBuilder(t *testing.T) {
 			},
 		).Build()
 
+	backoff, ok := task.retryPolicy.(Intervals)
+	if !ok {
+		t.Fatalf("TaskBuilder set wrong task retry policy: got %T want %T", task.retryPolicy, backoff)
+	}
 	if task.maxRetries != 3 {
 		t.Errorf("TaskBuilder set wrong task maxRetries: got %v want %v", task.maxRetries, 3)
 	}
-	if task.backoff[0] != 1*time.Second {
-		t.Errorf("TaskBuilder set wrong task backoff interval: got %v want %v", task.backoff[0], 1*time.Second)
+	if backoff[0] != 1*time.Second {
+		t.Errorf("TaskBuilder set wrong task backoff interval: got %v want %v", backoff[0], 1*time.Second)
 	}
-	if task.backoff[1] != 2*time.Second {
-		t.Errorf("TaskBuilder set wrong task backoff interval: got %v want %v", task.backoff[1], 2*time.Second)
+	if backoff[1] != 2*time.Second {
+		t.Errorf("TaskBuilder set wrong task backoff interval: got %v want %v", backoff[1], 2*time.Second)
 	}
-	if task.backoff[2] != 3*time.Second {
-		t.Errorf("TaskBuilder set wrong task backoff interval: got %v want %v", task.backoff[2], 3*time.Second)
+	if backoff[2] != 3*time.Second {
+		t.Errorf("TaskBuilder set wrong task backoff interval: got %v want %v", backoff[2], 3*time.Second)
 	}
 }
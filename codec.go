@@ -0,0 +1,150 @@
+package iocast
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrCodecNotRegistered = errors.New("codec is not registered")
+)
+
+// Codec encodes values to bytes and decodes them back.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// ContentType names the encoding, it is stored along with the encoded values
+	// so that they can be decoded with the same codec.
+	ContentType() string
+}
+
+type jsonCodec struct{}
+
+// JSONCodec is a codec based on encoding/json.
+var JSONCodec Codec = jsonCodec{}
+
+// Marshal encodes the value as JSON.
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the JSON data into the value.
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ContentType returns application/json.
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+type gobCodec struct{}
+
+// GobCodec is a codec based on encoding/gob. Unlike JSON, it keeps durations, binary
+// payloads and the concrete types registered with gob.Register behind interfaces.
+var GobCodec Codec = gobCodec{}
+
+// Marshal encodes the value with gob.
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes the gob data into the value.
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ContentType returns application/x-gob.
+func (gobCodec) ContentType() string {
+	return "application/x-gob"
+}
+
+// codecs holds the codecs stored values can be decoded with, by content type.
+var codecs = struct {
+	mu            sync.RWMutex
+	byContentType map[string]Codec
+}{
+	byContentType: map[string]Codec{
+		JSONCodec.ContentType(): JSONCodec,
+		GobCodec.ContentType():  GobCodec,
+	},
+}
+
+// RegisterCodec registers a codec so that the values it encoded can be decoded by any
+// database, even one that writes with another codec. JSON and gob are registered by default.
+func RegisterCodec(c Codec) {
+	codecs.mu.Lock()
+	defer codecs.mu.Unlock()
+	codecs.byContentType[c.ContentType()] = c
+}
+
+func codecFor(contentType string) (Codec, error) {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+	c, ok := codecs.byContentType[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrCodecNotRegistered, contentType)
+	}
+	return c, nil
+}
+
+// EncodedOutput is the output of a stored result as it was encoded, since it
+// can only be decoded once its type is known. ReadResult and ListResults decode it.
+type EncodedOutput struct {
+	// ContentType is the content type of the codec that encoded the output.
+	ContentType string
+	Data        []byte
+}
+
+// Decode decodes the output into v with the codec that encoded it.
+func (o EncodedOutput) Decode(v any) error {
+	c, err := codecFor(o.ContentType)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(o.Data, v)
+}
+
+// encodedResult is the stored form of a result, with its output encoded by a codec.
+type encodedResult struct {
+	Codec    string         `json:"codec"`
+	Out      []byte         `json:"out,omitempty"`
+	Err      *ErrorEnvelope `json:"err,omitempty"`
+	Metadata Metadata       `json:"metadata"`
+}
+
+func encodeResult(c Codec, r Result[any]) (encodedResult, error) {
+	e := encodedResult{
+		Codec:    c.ContentType(),
+		Err:      newErrorEnvelope(r.Err, r.retryable),
+		Metadata: r.Metadata,
+	}
+	if r.Out != nil {
+		out, err := c.Marshal(r.Out)
+		if err != nil {
+			return encodedResult{}, fmt.Errorf("error encoding the output: %w", err)
+		}
+		e.Out = out
+	}
+	return e, nil
+}
+
+// result returns the result with its output left encoded.
+func (e encodedResult) result() Result[any] {
+	r := Result[any]{
+		Err:      e.Err.Err(),
+		Metadata: e.Metadata,
+	}
+	if e.Out != nil {
+		r.Out = EncodedOutput{ContentType: e.Codec, Data: e.Out}
+	}
+	return r
+}
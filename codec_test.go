@@ -0,0 +1,82 @@
+package iocast
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCodecOut struct {
+	Delay   time.Duration
+	Payload []byte
+	Labels  map[string]string
+}
+
+func TestCodecs(t *testing.T) {
+	out := testCodecOut{
+		Delay:   1500 * time.Millisecond,
+		Payload: []byte{0x00, 0xff, 0x10},
+		Labels:  map[string]string{"env": "prod"},
+	}
+
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			data, err := codec.Marshal(out)
+			if err != nil {
+				t.Fatalf("Marshal returned unexpected error: %v", err)
+			}
+			var decoded testCodecOut
+			if err := codec.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal returned unexpected error: %v", err)
+			}
+			if decoded.Delay != out.Delay || string(decoded.Payload) != string(out.Payload) || decoded.Labels["env"] != "prod" {
+				t.Errorf("unexpected decoded value: got %+v want %+v", decoded, out)
+			}
+		})
+	}
+}
+
+func TestMixedCodecs(t *testing.T) {
+	m := &sync.Map{}
+	gobDB := NewMemDBWithCodec(m, GobCodec)
+	jsonDB := NewMemDB(m)
+
+	out := testCodecOut{Delay: time.Second, Payload: []byte("binary")}
+	if err := gobDB.Write("gob", Result[any]{Out: out}); err != nil {
+		t.Fatalf("Write returned unexpected error: %v", err)
+	}
+	if err := jsonDB.Write("json", Result[any]{Out: out}); err != nil {
+		t.Fatalf("Write returned unexpected error: %v", err)
+	}
+
+	// both results are decoded with the codec that encoded them, whatever the codec of the reader
+	for _, id := range []string{"gob", "json"} {
+		result, err := ReadResult[testCodecOut](jsonDB, id)
+		if err != nil {
+			t.Fatalf("ReadResult returned unexpected error for %s: %v", id, err)
+		}
+		if result.Out.Delay != out.Delay || string(result.Out.Payload) != "binary" {
+			t.Errorf("unexpected output for %s: got %+v want %+v", id, result.Out, out)
+		}
+	}
+
+	reader, ok := jsonDB.(Reader)
+	if !ok {
+		t.Fatalf("database %T is not a Reader", jsonDB)
+	}
+	raw, err := reader.Read("gob")
+	if err != nil {
+		t.Fatalf("Read returned unexpected error: %v", err)
+	}
+	encoded, ok := raw.Out.(EncodedOutput)
+	if !ok || encoded.ContentType != GobCodec.ContentType() {
+		t.Errorf("unexpected raw output: got %+v", raw.Out)
+	}
+
+	unknown := EncodedOutput{ContentType: "application/x-unknown", Data: encoded.Data}
+	var decoded testCodecOut
+	if err := unknown.Decode(&decoded); !errors.Is(err, ErrCodecNotRegistered) {
+		t.Errorf("unexpected error decoding with an unknown codec: got %v want %v", err, ErrCodecNotRegistered)
+	}
+}
@@ -0,0 +1,44 @@
+package iocast
+
+import (
+	"context"
+)
+
+// mergedContext is done as soon as either of its parents is, and looks values up
+// in the execution context first and in the build-time context after.
+type mergedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c mergedContext) Value(key any) any {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+	return c.values.Value(key)
+}
+
+// mergeContexts merges the context a task func was built with into the context it is executed with.
+func mergeContexts(build, exec context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(exec)
+	cancelDeadline := func() {}
+	if deadline, ok := build.Deadline(); ok {
+		ctx, cancelDeadline = context.WithDeadline(ctx, deadline)
+	}
+
+	var stop func() bool
+	if build.Err() != nil {
+		cancel(context.Cause(build))
+		stop = func() bool { return false }
+	} else {
+		stop = context.AfterFunc(build, func() {
+			cancel(context.Cause(build))
+		})
+	}
+
+	return mergedContext{Context: ctx, values: build}, func() {
+		stop()
+		cancelDeadline()
+		cancel(context.Canceled)
+	}
+}
@@ -0,0 +1,104 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testContextKey string
+
+func TestMergeContexts(t *testing.T) {
+	t.Run("cancelled with the execution context", func(t *testing.T) {
+		exec, cancelExec := context.WithCancel(context.Background())
+		ctx, cancel := mergeContexts(context.Background(), exec)
+		defer cancel()
+
+		cancelExec()
+		<-ctx.Done()
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			t.Errorf("unexpected context error: got %v want %v", ctx.Err(), context.Canceled)
+		}
+	})
+
+	t.Run("cancelled with the build-time context", func(t *testing.T) {
+		build, cancelBuild := context.WithCancelCause(context.Background())
+		ctx, cancel := mergeContexts(build, context.Background())
+		defer cancel()
+
+		cause := errors.New("build-time context cancelled")
+		cancelBuild(cause)
+		<-ctx.Done()
+		if context.Cause(ctx) != cause {
+			t.Errorf("unexpected context cause: got %v want %v", context.Cause(ctx), cause)
+		}
+	})
+
+	t.Run("already cancelled build-time context", func(t *testing.T) {
+		build, cancelBuild := context.WithCancel(context.Background())
+		cancelBuild()
+		ctx, cancel := mergeContexts(build, context.Background())
+		defer cancel()
+
+		if ctx.Err() == nil {
+			t.Error("merged context is not done")
+		}
+	})
+
+	t.Run("earliest deadline", func(t *testing.T) {
+		deadline := time.Now().Add(time.Minute)
+		build, cancelBuild := context.WithDeadline(context.Background(), deadline)
+		defer cancelBuild()
+		exec, cancelExec := context.WithDeadline(context.Background(), deadline.Add(time.Minute))
+		defer cancelExec()
+
+		ctx, cancel := mergeContexts(build, exec)
+		defer cancel()
+
+		if d, ok := ctx.Deadline(); !ok || !d.Equal(deadline) {
+			t.Errorf("unexpected deadline: got %v want %v", d, deadline)
+		}
+	})
+
+	t.Run("values from both contexts", func(t *testing.T) {
+		build := context.WithValue(context.Background(), testContextKey("build"), "build")
+		exec := context.WithValue(context.Background(), testContextKey("exec"), "exec")
+		ctx, cancel := mergeContexts(build, exec)
+		defer cancel()
+
+		for _, key := range []string{"build", "exec"} {
+			if v := ctx.Value(testContextKey(key)); v != key {
+				t.Errorf("unexpected value: got %v want %v", v, key)
+			}
+		}
+	})
+}
+
+func TestWorkerPoolContextReachesTaskFn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewWorkerPool(1, 1)
+	p.Start(ctx)
+	defer p.Stop()
+
+	started := make(chan struct{})
+	taskFn := NewTaskFunc(context.Background(), "args", func(ctx context.Context, _ string) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	task := TaskBuilder("uuid", taskFn).Build()
+	p.Enqueue(task)
+
+	<-started
+	cancel()
+
+	select {
+	case result := <-task.Wait():
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("unexpected result error: got %v want %v", result.Err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelling the pool context did not reach the task func")
+	}
+}
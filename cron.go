@@ -0,0 +1,242 @@
+package iocast
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCronExpression = errors.New("invalid cron expression")
+)
+
+// Recurrence computes the occurrences of a periodic schedule.
+type Recurrence interface {
+	// Next returns the first occurrence strictly after the given time.
+	Next(after time.Time) time.Time
+	// String returns the textual form of the recurrence, accepted by Cron.
+	String() string
+}
+
+type interval struct {
+	d time.Duration
+}
+
+// Every returns a recurrence that repeats at a fixed interval.
+func Every(d time.Duration) Recurrence {
+	return interval{d: d}
+}
+
+// Next returns the given time plus the interval.
+func (i interval) Next(after time.Time) time.Time {
+	return after.Add(i.d)
+}
+
+func (i interval) String() string {
+	return "@every " + i.d.String()
+}
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondBounds = bounds{0, 59, nil}
+	minuteBounds = bounds{0, 59, nil}
+	hourBounds   = bounds{0, 23, nil}
+	domBounds    = bounds{1, 31, nil}
+	monthBounds  = bounds{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowBounds = bounds{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// maxCronLookahead bounds the search for the next occurrence of expressions that never match, e.g. Feb 30th.
+const maxCronLookahead = 5
+
+type cronSchedule struct {
+	expr                                  string
+	second, minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted          bool
+}
+
+// Cron parses a standard cron expression and returns its recurrence.
+//
+// Both the 5-field form (minute hour day-of-month month day-of-week) and the
+// 6-field form with a leading seconds field are accepted, along with the
+// @yearly, @monthly, @weekly, @daily, @hourly and @every <duration> descriptors.
+func Cron(expr string) (Recurrence, error) {
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidCronExpression, expr, err)
+		}
+		return Every(d), nil
+	}
+	if descriptor, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("%w: %q: expected 5 or 6 fields, got %d", ErrInvalidCronExpression, expr, len(fields))
+	}
+
+	c := &cronSchedule{expr: strings.TrimSpace(expr)}
+	var err error
+	if c.second, err = parseCronField(fields[0], secondBounds); err != nil {
+		return nil, fmt.Errorf("%w: %q: seconds: %v", ErrInvalidCronExpression, expr, err)
+	}
+	if c.minute, err = parseCronField(fields[1], minuteBounds); err != nil {
+		return nil, fmt.Errorf("%w: %q: minutes: %v", ErrInvalidCronExpression, expr, err)
+	}
+	if c.hour, err = parseCronField(fields[2], hourBounds); err != nil {
+		return nil, fmt.Errorf("%w: %q: hours: %v", ErrInvalidCronExpression, expr, err)
+	}
+	if c.dom, err = parseCronField(fields[3], domBounds); err != nil {
+		return nil, fmt.Errorf("%w: %q: day of month: %v", ErrInvalidCronExpression, expr, err)
+	}
+	if c.month, err = parseCronField(fields[4], monthBounds); err != nil {
+		return nil, fmt.Errorf("%w: %q: month: %v", ErrInvalidCronExpression, expr, err)
+	}
+	if c.dow, err = parseCronField(fields[5], dowBounds); err != nil {
+		return nil, fmt.Errorf("%w: %q: day of week: %v", ErrInvalidCronExpression, expr, err)
+	}
+	// 7 is an alias of Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domRestricted = !isWildcard(fields[3])
+	c.dowRestricted = !isWildcard(fields[5])
+	return c, nil
+}
+
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+func parseCronField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepExpr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepExpr)
+			}
+		}
+
+		var low, high int
+		switch {
+		case isWildcard(rangeExpr):
+			low, high = b.min, b.max
+		default:
+			lowExpr, highExpr, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			if low, err = parseCronValue(lowExpr, b); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = parseCronValue(highExpr, b); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "a/n" is shorthand for "a-max/n".
+				high = b.max
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range %q", rangeExpr)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, b bounds) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after the given one that matches the expression.
+// It returns the zero time if there is no such time within the next few years.
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Add(time.Second - time.Duration(after.Nanosecond()))
+	limit := t.Year() + maxCronLookahead
+
+	for t.Year() <= limit {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if c.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows the cron convention where a day matches either
+// restricted field when both day-of-month and day-of-week are restricted.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func (c *cronSchedule) String() string {
+	return c.expr
+}
@@ -0,0 +1,115 @@
+package iocast
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	from := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC) // Friday
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected time.Time
+	}{
+		{
+			"every minute",
+			"* * * * *",
+			time.Date(2024, time.March, 15, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			"every 15 minutes",
+			"*/15 * * * *",
+			time.Date(2024, time.March, 15, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			"six fields with seconds",
+			"30 * * * * *",
+			time.Date(2024, time.March, 15, 10, 30, 30, 0, time.UTC),
+		},
+		{
+			"daily at a fixed hour",
+			"0 9 * * *",
+			time.Date(2024, time.March, 16, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			"weekdays by name",
+			"0 9 * * mon-fri",
+			time.Date(2024, time.March, 18, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			"sunday as 7",
+			"0 0 * * 7",
+			time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"month rollover",
+			"0 0 1 * *",
+			time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"leap day",
+			"0 0 29 2 *",
+			time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"day of month or day of week",
+			"0 0 20 * sun",
+			time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"descriptor",
+			"@monthly",
+			time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"every descriptor",
+			"@every 90m",
+			time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Cron(tt.expr)
+			if err != nil {
+				t.Fatalf("Cron returned unexpected error: %v", err)
+			}
+			next := r.Next(from)
+			if !next.Equal(tt.expected) {
+				t.Errorf("Next returned unexpected time: got %v want %v", next, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	exprs := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every never",
+	}
+	for _, expr := range exprs {
+		_, err := Cron(expr)
+		if !errors.Is(err, ErrInvalidCronExpression) {
+			t.Errorf("Cron(%q) returned unexpected error: got %v want %v", expr, err, ErrInvalidCronExpression)
+		}
+	}
+}
+
+func TestCronNeverMatches(t *testing.T) {
+	r, err := Cron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Cron returned unexpected error: %v", err)
+	}
+	if next := r.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Next returned unexpected time: got %v want zero time", next)
+	}
+}
@@ -2,7 +2,17 @@ package iocast
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
 	"sync"
+	"time"
+)
+
+var (
+	ErrResultNotFound       = errors.New("result not found")
+	ErrUnsupportedOperation = errors.New("operation not supported by the database")
 )
 
 // DB represents a storage.
@@ -10,23 +20,212 @@ type DB interface {
 	Write(string, Result[any]) error
 }
 
+// Reader is implemented by the databases that can read a result back.
+type Reader interface {
+	// Read returns the result with the given id, or ErrResultNotFound.
+	// The output of the result may be left as an EncodedOutput.
+	Read(id string) (Result[any], error)
+}
+
+// Lister is implemented by the databases that can query their results.
+type Lister interface {
+	// List returns the results matching the filter in the order they were created.
+	List(Filter) ([]Record[any], error)
+}
+
+// Deleter is implemented by the databases that can delete a result.
+type Deleter interface {
+	// Delete removes the result with the given id, it is a no-op if there is no such result.
+	Delete(id string) error
+}
+
+// Record is a stored result along with the id of its task.
+type Record[T any] struct {
+	ID     string
+	Result Result[T]
+}
+
+// Filter selects stored results. Its zero value matches every result.
+type Filter struct {
+	// Status matches the results with the given status.
+	Status status
+	// From and To match the results of the tasks created in [From, To).
+	From time.Time
+	To   time.Time
+	// Tag matches the results of the tasks tagged with it.
+	Tag string
+}
+
+// Match reports whether the metadata of a result matches the filter.
+func (f Filter) Match(m Metadata) bool {
+	if f.Status != nil && f.Status != m.Status {
+		return false
+	}
+	if !f.From.IsZero() && m.CreatetAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !m.CreatetAt.Before(f.To) {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(m.Tags, f.Tag) {
+		return false
+	}
+	return true
+}
+
+// ReadResult reads the result with the given id from the database and converts its output to T.
+func ReadResult[T any](db DB, id string) (Result[T], error) {
+	r, ok := db.(Reader)
+	if !ok {
+		return Result[T]{}, fmt.Errorf("%w: read", ErrUnsupportedOperation)
+	}
+	result, err := r.Read(id)
+	if err != nil {
+		return Result[T]{}, err
+	}
+	return convertResult[T](result)
+}
+
+// ListResults lists the results matching the filter from the database and converts their output to T.
+func ListResults[T any](db DB, f Filter) ([]Record[T], error) {
+	l, ok := db.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("%w: list", ErrUnsupportedOperation)
+	}
+	records, err := l.List(f)
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]Record[T], 0, len(records))
+	for _, rec := range records {
+		result, err := convertResult[T](rec.Result)
+		if err != nil {
+			return nil, fmt.Errorf("error converting the result of %s: %w", rec.ID, err)
+		}
+		typed = append(typed, Record[T]{ID: rec.ID, Result: result})
+	}
+	return typed, nil
+}
+
+// DeleteResult deletes the result with the given id from the database.
+func DeleteResult(db DB, id string) error {
+	d, ok := db.(Deleter)
+	if !ok {
+		return fmt.Errorf("%w: delete", ErrUnsupportedOperation)
+	}
+	return d.Delete(id)
+}
+
+// convertResult converts the output of a stored result to T, decoding it if it is
+// still encoded or going through JSON if it was decoded into generic values.
+func convertResult[T any](r Result[any]) (Result[T], error) {
+	typed := Result[T]{
+		Err:      r.Err,
+		Metadata: r.Metadata,
+	}
+	if r.Out == nil {
+		return typed, nil
+	}
+	if encoded, ok := r.Out.(EncodedOutput); ok {
+		if err := encoded.Decode(&typed.Out); err != nil {
+			return Result[T]{}, err
+		}
+		return typed, nil
+	}
+	if out, ok := r.Out.(T); ok {
+		typed.Out = out
+		return typed, nil
+	}
+	data, err := json.Marshal(r.Out)
+	if err != nil {
+		return Result[T]{}, err
+	}
+	if err := json.Unmarshal(data, &typed.Out); err != nil {
+		return Result[T]{}, err
+	}
+	return typed, nil
+}
+
 type MemDB struct {
-	db *sync.Map
+	db    *sync.Map
+	codec Codec
 }
 
-// NewMemDB creates and returns a new memDB instance.
+// NewMemDB creates and returns a new memDB instance that encodes outputs as JSON.
 func NewMemDB(db *sync.Map) DB {
+	return NewMemDBWithCodec(db, JSONCodec)
+}
+
+// NewMemDBWithCodec creates and returns a new memDB instance that encodes outputs with the given codec.
+func NewMemDBWithCodec(db *sync.Map, codec Codec) DB {
 	return &MemDB{
-		db: db,
+		db:    db,
+		codec: codec,
 	}
 }
 
 // Write stores the results to the database.
 func (w *MemDB) Write(id string, r Result[any]) error {
-	data, err := json.Marshal(r)
+	e, err := encodeResult(w.codec, r)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
 	if err != nil {
 		return err
 	}
 	w.db.Store(id, data)
 	return nil
 }
+
+// Read returns the result with the given id.
+func (w *MemDB) Read(id string) (Result[any], error) {
+	data, ok := w.db.Load(id)
+	if !ok {
+		return Result[any]{}, fmt.Errorf("%w: %s", ErrResultNotFound, id)
+	}
+	var e encodedResult
+	if err := json.Unmarshal(data.([]byte), &e); err != nil {
+		return Result[any]{}, err
+	}
+	return e.result(), nil
+}
+
+// List returns the results matching the filter in the order they were created.
+func (w *MemDB) List(f Filter) ([]Record[any], error) {
+	var records []Record[any]
+	var err error
+	w.db.Range(func(key, value any) bool {
+		var e encodedResult
+		if err = json.Unmarshal(value.([]byte), &e); err != nil {
+			err = fmt.Errorf("error decoding the result of %v: %w", key, err)
+			return false
+		}
+		if f.Match(e.Metadata) {
+			records = append(records, Record[any]{ID: key.(string), Result: e.result()})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// sortRecords sorts the records in the order their tasks were created.
+func sortRecords(records []Record[any]) {
+	sort.Slice(records, func(i, j int) bool {
+		ti, tj := records[i].Result.Metadata.CreatetAt, records[j].Result.Metadata.CreatetAt
+		if ti.Equal(tj) {
+			return records[i].ID < records[j].ID
+		}
+		return ti.Before(tj)
+	})
+}
+
+// Delete removes the result with the given id.
+func (w *MemDB) Delete(id string) error {
+	w.db.Delete(id)
+	return nil
+}
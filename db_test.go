@@ -0,0 +1,134 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testDBOut struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type testWriteOnlyDB struct{}
+
+func (testWriteOnlyDB) Write(string, Result[any]) error { return nil }
+
+func TestMemDB(t *testing.T) {
+	db := NewMemDB(&sync.Map{})
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	results := []struct {
+		id     string
+		result Result[any]
+	}{
+		{"first", Result[any]{
+			Out:      testDBOut{Name: "first", Count: 1},
+			Metadata: Metadata{CreatetAt: created, Status: TaskStatusSuccess, Tags: []string{"a"}},
+		}},
+		{"second", Result[any]{
+			Err:      ErrTaskTimedOut,
+			Metadata: Metadata{CreatetAt: created.Add(time.Hour), Status: TaskStatusTimedOut, Tags: []string{"a", "b"}},
+		}},
+		{"third", Result[any]{
+			Out:      testDBOut{Name: "third", Count: 3},
+			Metadata: Metadata{CreatetAt: created.Add(2 * time.Hour), Status: TaskStatusSuccess, Tags: []string{"b"}},
+		}},
+	}
+	for _, r := range results {
+		if err := db.Write(r.id, r.result); err != nil {
+			t.Fatalf("unexpected error writing %s: %v", r.id, err)
+		}
+	}
+
+	result, err := ReadResult[testDBOut](db, "third")
+	if err != nil {
+		t.Fatalf("unexpected error reading the result: %v", err)
+	}
+	if result.Out != (testDBOut{Name: "third", Count: 3}) {
+		t.Errorf("unexpected result out: got %+v want %+v", result.Out, testDBOut{Name: "third", Count: 3})
+	}
+	if result.Metadata.Status != TaskStatusSuccess {
+		t.Errorf("unexpected result status: got %v want %v", result.Metadata.Status, TaskStatusSuccess)
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{"no filter", Filter{}, []string{"first", "second", "third"}},
+		{"status", Filter{Status: TaskStatusSuccess}, []string{"first", "third"}},
+		{"time range", Filter{From: created.Add(time.Hour), To: created.Add(2 * time.Hour)}, []string{"second"}},
+		{"tag", Filter{Tag: "b"}, []string{"second", "third"}},
+		{"status and tag", Filter{Status: TaskStatusSuccess, Tag: "a"}, []string{"first"}},
+		{"no match", Filter{Tag: "c"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ListResults[testDBOut](db, tt.filter)
+			if err != nil {
+				t.Fatalf("unexpected error listing the results: %v", err)
+			}
+			var ids []string
+			for _, rec := range records {
+				ids = append(ids, rec.ID)
+			}
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("unexpected results: got %v want %v", ids, tt.expected)
+			}
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Errorf("unexpected results: got %v want %v", ids, tt.expected)
+				}
+			}
+		})
+	}
+
+	records, _ := ListResults[testDBOut](db, Filter{Status: TaskStatusTimedOut})
+	if len(records) != 1 || !errors.Is(records[0].Result.Err, ErrTaskTimedOut) {
+		t.Errorf("unexpected timed out results: got %+v", records)
+	}
+
+	if err := DeleteResult(db, "first"); err != nil {
+		t.Fatalf("unexpected error deleting the result: %v", err)
+	}
+	if _, err := ReadResult[testDBOut](db, "first"); !errors.Is(err, ErrResultNotFound) {
+		t.Errorf("unexpected error reading a deleted result: got %v want %v", err, ErrResultNotFound)
+	}
+}
+
+func TestWriteOnlyDB(t *testing.T) {
+	db := testWriteOnlyDB{}
+	if _, err := ReadResult[string](db, "uuid"); !errors.Is(err, ErrUnsupportedOperation) {
+		t.Errorf("unexpected Read error: got %v want %v", err, ErrUnsupportedOperation)
+	}
+	if _, err := ListResults[string](db, Filter{}); !errors.Is(err, ErrUnsupportedOperation) {
+		t.Errorf("unexpected List error: got %v want %v", err, ErrUnsupportedOperation)
+	}
+	if err := DeleteResult(db, "uuid"); !errors.Is(err, ErrUnsupportedOperation) {
+		t.Errorf("unexpected Delete error: got %v want %v", err, ErrUnsupportedOperation)
+	}
+}
+
+func TestTaskTags(t *testing.T) {
+	db := NewMemDB(&sync.Map{})
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	task := TaskBuilder("uuid", taskFn).Tags("reports", "daily").Database(db).Build()
+
+	task.Exec(context.Background())
+	if err := task.Write(); err != nil {
+		t.Fatalf("unexpected error writing the result: %v", err)
+	}
+
+	records, err := ListResults[string](db, Filter{Tag: "daily"})
+	if err != nil {
+		t.Fatalf("unexpected error listing the results: %v", err)
+	}
+	if len(records) != 1 || records[0].Result.Out != "args" {
+		t.Errorf("unexpected results: got %+v", records)
+	}
+}
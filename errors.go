@@ -0,0 +1,337 @@
+package iocast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	ErrErrorAlreadyRegistered = errors.New("error is already registered")
+)
+
+// sentinels holds the errors that keep their identity when they are stored and restored.
+var sentinels = struct {
+	mu     sync.RWMutex
+	byName map[string]error
+}{
+	byName: map[string]error{
+		"iocast.ErrTaskTimedOut":   ErrTaskTimedOut,
+		"iocast.ErrTaskCancelled":  ErrTaskCancelled,
+		"context.Canceled":         context.Canceled,
+		"context.DeadlineExceeded": context.DeadlineExceeded,
+	},
+}
+
+// RegisterError registers a sentinel error under the given name, so that errors.Is
+// keeps matching it in results restored from a database.
+func RegisterError(name string, err error) error {
+	sentinels.mu.Lock()
+	defer sentinels.mu.Unlock()
+	if _, ok := sentinels.byName[name]; ok {
+		return fmt.Errorf("%w: %s", ErrErrorAlreadyRegistered, name)
+	}
+	sentinels.byName[name] = err
+	return nil
+}
+
+// sentinelName returns the name the error is registered under, if it is a registered sentinel.
+func sentinelName(err error) string {
+	sentinels.mu.RLock()
+	defer sentinels.mu.RUnlock()
+	for name, sentinel := range sentinels.byName {
+		if err == sentinel {
+			return name
+		}
+	}
+	return ""
+}
+
+func sentinel(name string) error {
+	sentinels.mu.RLock()
+	defer sentinels.mu.RUnlock()
+	return sentinels.byName[name]
+}
+
+// errorTypes holds the error types whose values are stored and restored as themselves.
+var errorTypes = struct {
+	mu     sync.RWMutex
+	byName map[string]func(data []byte) (error, error)
+	byType map[reflect.Type]string
+}{
+	byName: make(map[string]func(data []byte) (error, error)),
+	byType: make(map[reflect.Type]string),
+}
+
+// RegisterErrorType registers the error type E under the given name, so that errors.As
+// keeps matching it in results restored from a database. The errors of the type are
+// stored as JSON, only their exported fields are restored.
+func RegisterErrorType[E error](name string) error {
+	errorTypes.mu.Lock()
+	defer errorTypes.mu.Unlock()
+	if _, ok := errorTypes.byName[name]; ok {
+		return fmt.Errorf("%w: %s", ErrErrorAlreadyRegistered, name)
+	}
+	errorTypes.byName[name] = func(data []byte) (error, error) {
+		var err E
+		if decodeErr := json.Unmarshal(data, &err); decodeErr != nil {
+			return nil, decodeErr
+		}
+		return err, nil
+	}
+	errorTypes.byType[reflect.TypeFor[E]()] = name
+	return nil
+}
+
+// encodeTyped returns the name the type of the error is registered under and the
+// encoded error, if its type is registered.
+func encodeTyped(err error) (string, json.RawMessage) {
+	errorTypes.mu.RLock()
+	name, ok := errorTypes.byType[reflect.TypeOf(err)]
+	errorTypes.mu.RUnlock()
+	if !ok {
+		return "", nil
+	}
+	data, marshalErr := json.Marshal(err)
+	if marshalErr != nil {
+		return "", nil
+	}
+	return name, data
+}
+
+// decodeTyped restores an error of a registered type, or returns nil if it cannot.
+func decodeTyped(name string, data []byte) error {
+	errorTypes.mu.RLock()
+	decode, ok := errorTypes.byName[name]
+	errorTypes.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	err, decodeErr := decode(data)
+	if decodeErr != nil {
+		return nil
+	}
+	return err
+}
+
+// StepError is the error of a pipeline that failed at one of its tasks.
+type StepError struct {
+	// Step is the position of the failed task in the pipeline, starting from 1.
+	Step int
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("error in task number %d: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorEnvelope is the serializable form of an error.
+type ErrorEnvelope struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	// Sentinel is the name of the error if it is a registered sentinel.
+	Sentinel string `json:"sentinel,omitempty"`
+	// TypeName and Data are the name and the encoded value of the error if its type is registered.
+	TypeName string          `json:"type_name,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	// Chain lists the errors wrapped by the error, depth first.
+	Chain []ErrorLink `json:"chain,omitempty"`
+	// Step is the position of the failed task in its pipeline, or zero for a standalone task.
+	Step      int  `json:"step,omitempty"`
+	Retryable bool `json:"retryable"`
+}
+
+// ErrorLink is an error wrapped by an enveloped error.
+type ErrorLink struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	// Sentinel is the name of the registered sentinel error, if any.
+	Sentinel string `json:"sentinel,omitempty"`
+	// TypeName and Data are the name and the encoded value of the error if its type is registered.
+	TypeName string          `json:"type_name,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// NewErrorEnvelope returns the envelope of the error, or nil if there is no error.
+// Its retryability is judged by the error alone, the results of tasks are stored
+// with the retryability their task judged their error with.
+func NewErrorEnvelope(err error) *ErrorEnvelope {
+	return newErrorEnvelope(err, nil)
+}
+
+// newErrorEnvelope returns the envelope of the error, with the given retryability if known.
+func newErrorEnvelope(err error, retryable *bool) *ErrorEnvelope {
+	if err == nil {
+		return nil
+	}
+	e := &ErrorEnvelope{
+		Message:   err.Error(),
+		Type:      errorType(err),
+		Sentinel:  sentinelName(err),
+		Retryable: isRetryable(err, nil),
+	}
+	e.TypeName, e.Data = encodeTyped(err)
+	var storedErr *StoredError
+	errors.As(err, &storedErr)
+	switch {
+	case retryable != nil:
+		e.Retryable = *retryable
+	case storedErr != nil:
+		// a restored error keeps the retryability it was stored with
+		e.Retryable = storedErr.Retryable
+	}
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		e.Step = stepErr.Step
+	}
+	if storedErr != nil && e.Step == 0 {
+		e.Step = storedErr.Step
+	}
+	for _, wrapped := range unwrapAll(err) {
+		link := ErrorLink{
+			Message:  wrapped.Error(),
+			Type:     errorType(wrapped),
+			Sentinel: sentinelName(wrapped),
+		}
+		link.TypeName, link.Data = encodeTyped(wrapped)
+		e.Chain = append(e.Chain, link)
+	}
+	return e
+}
+
+// Err restores the enveloped error. Registered sentinels and errors of registered types
+// in its chain are restored as themselves, the rest of the errors as a StoredError.
+func (e *ErrorEnvelope) Err() error {
+	if e == nil {
+		return nil
+	}
+	stored := &StoredError{
+		Message:   e.Message,
+		Type:      e.Type,
+		Step:      e.Step,
+		Retryable: e.Retryable,
+	}
+	if err := sentinel(e.Sentinel); err != nil {
+		stored.chain = append(stored.chain, err)
+	} else if err := decodeTyped(e.TypeName, e.Data); err != nil {
+		stored.chain = append(stored.chain, err)
+	}
+	for _, link := range e.Chain {
+		if err := sentinel(link.Sentinel); err != nil {
+			stored.chain = append(stored.chain, err)
+			continue
+		}
+		if err := decodeTyped(link.TypeName, link.Data); err != nil {
+			stored.chain = append(stored.chain, err)
+			continue
+		}
+		stored.chain = append(stored.chain, &StoredError{
+			Message: link.Message,
+			Type:    link.Type,
+		})
+	}
+	return stored
+}
+
+// StoredError is an error restored from a database.
+type StoredError struct {
+	Message string
+	// Type is the type name of the original error.
+	Type      string
+	Step      int
+	Retryable bool
+	chain     []error
+}
+
+func (e *StoredError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the errors the original error wrapped.
+func (e *StoredError) Unwrap() []error {
+	return e.chain
+}
+
+func errorType(err error) string {
+	if stored, ok := err.(*StoredError); ok {
+		return stored.Type
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// unwrapAll returns the whole tree of errors wrapped by the error, depth first.
+func unwrapAll(err error) []error {
+	var wrapped []error
+	switch e := err.(type) {
+	case *StoredError:
+		// the chain of a stored error is already flattened
+		return e.chain
+	case interface{ Unwrap() error }:
+		if next := e.Unwrap(); next != nil {
+			wrapped = append(wrapped, next)
+			wrapped = append(wrapped, unwrapAll(next)...)
+		}
+	case interface{ Unwrap() []error }:
+		for _, next := range e.Unwrap() {
+			if next == nil {
+				continue
+			}
+			wrapped = append(wrapped, next)
+			wrapped = append(wrapped, unwrapAll(next)...)
+		}
+	}
+	return wrapped
+}
+
+// MarshalJSON encodes the result with its error as an ErrorEnvelope.
+func (r Result[T]) MarshalJSON() ([]byte, error) {
+	type result Result[T]
+	return json.Marshal(struct {
+		result
+		Err *ErrorEnvelope `json:"err"`
+	}{
+		result: result(r),
+		Err:    newErrorEnvelope(r.Err, r.retryable),
+	})
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON, restoring its error.
+func (r *Result[T]) UnmarshalJSON(data []byte) error {
+	type result Result[T]
+	aux := struct {
+		*result
+		Err *ErrorEnvelope `json:"err"`
+	}{
+		result: (*result)(r),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.Err = aux.Err.Err()
+	return nil
+}
+
+// UnmarshalJSON decodes the metadata, restoring its status.
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	type metadata Metadata
+	aux := struct {
+		*metadata
+		Status *taskStatus `json:"status"`
+	}{
+		metadata: (*metadata)(m),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Status != nil {
+		m.Status = *aux.Status
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package iocast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errTestSentinel = errors.New("test sentinel")
+
+type testTypedError struct {
+	Code int `json:"code"`
+}
+
+func (e *testTypedError) Error() string {
+	return fmt.Sprintf("code %d", e.Code)
+}
+
+var registerTestErrorsOnce sync.Once
+
+// registerTestErrors registers the errors the tests restore, once since the registrations are global.
+func registerTestErrors(t *testing.T) {
+	t.Helper()
+	var err error
+	registerTestErrorsOnce.Do(func() {
+		err = errors.Join(
+			RegisterError("iocast.errTestSentinel", errTestSentinel),
+			RegisterErrorType[*testTypedError]("iocast.testTypedError"),
+		)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error registering the test errors: %v", err)
+	}
+}
+
+func TestRegisterError(t *testing.T) {
+	registerTestErrors(t)
+	err := RegisterError("iocast.ErrTaskTimedOut", errors.New("other"))
+	if !errors.Is(err, ErrErrorAlreadyRegistered) {
+		t.Errorf("unexpected error: got %v want %v", err, ErrErrorAlreadyRegistered)
+	}
+	err = RegisterErrorType[*StepError]("iocast.testTypedError")
+	if !errors.Is(err, ErrErrorAlreadyRegistered) {
+		t.Errorf("unexpected error: got %v want %v", err, ErrErrorAlreadyRegistered)
+	}
+}
+
+func TestErrorEnvelopeRegisteredType(t *testing.T) {
+	registerTestErrors(t)
+	for _, err := range []error{
+		&testTypedError{Code: 42},
+		fmt.Errorf("wrapped: %w", &testTypedError{Code: 42}),
+	} {
+		data, marshalErr := json.Marshal(NewErrorEnvelope(err))
+		if marshalErr != nil {
+			t.Fatalf("unexpected error encoding the envelope: %v", marshalErr)
+		}
+		var envelope *ErrorEnvelope
+		if unmarshalErr := json.Unmarshal(data, &envelope); unmarshalErr != nil {
+			t.Fatalf("unexpected error decoding the envelope: %v", unmarshalErr)
+		}
+		restored := envelope.Err()
+
+		var typed *testTypedError
+		if !errors.As(restored, &typed) {
+			t.Fatalf("restored error %v is not a %T", restored, typed)
+		}
+		if typed.Code != 42 {
+			t.Errorf("unexpected code of the restored error: got %v want %v", typed.Code, 42)
+		}
+		if restored.Error() != err.Error() {
+			t.Errorf("unexpected message: got %q want %q", restored.Error(), err.Error())
+		}
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	registerTestErrors(t)
+	unregistered := errors.New("unregistered")
+
+	tests := []struct {
+		name      string
+		err       error
+		step      int
+		retryable bool
+		is        []error
+		isNot     []error
+	}{
+		{
+			"nil error",
+			nil,
+			0,
+			false,
+			nil,
+			nil,
+		},
+		{
+			"registered sentinel",
+			fmt.Errorf("wrapped: %w", errTestSentinel),
+			0,
+			true,
+			[]error{errTestSentinel},
+			[]error{ErrTaskTimedOut},
+		},
+		{
+			"unregistered sentinel",
+			fmt.Errorf("wrapped: %w", unregistered),
+			0,
+			true,
+			nil,
+			[]error{unregistered},
+		},
+		{
+			"permanent error",
+			Permanent(errTestSentinel),
+			0,
+			false,
+			[]error{errTestSentinel},
+			nil,
+		},
+		{
+			"pipeline step timed out",
+			&StepError{Step: 2, Err: fmt.Errorf("%w: %w", ErrTaskTimedOut, context.DeadlineExceeded)},
+			2,
+			true,
+			[]error{ErrTaskTimedOut, context.DeadlineExceeded},
+			[]error{ErrTaskCancelled},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(NewErrorEnvelope(tt.err))
+			if err != nil {
+				t.Fatalf("unexpected error encoding the envelope: %v", err)
+			}
+			var envelope *ErrorEnvelope
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				t.Fatalf("unexpected error decoding the envelope: %v", err)
+			}
+			restored := envelope.Err()
+
+			if tt.err == nil {
+				if restored != nil {
+					t.Errorf("unexpected restored error: got %v want nil", restored)
+				}
+				return
+			}
+			if restored.Error() != tt.err.Error() {
+				t.Errorf("unexpected message: got %q want %q", restored.Error(), tt.err.Error())
+			}
+			var stored *StoredError
+			if !errors.As(restored, &stored) {
+				t.Fatalf("restored error is not a StoredError: %T", restored)
+			}
+			if stored.Type != fmt.Sprintf("%T", tt.err) {
+				t.Errorf("unexpected type: got %v want %T", stored.Type, tt.err)
+			}
+			if stored.Step != tt.step {
+				t.Errorf("unexpected step: got %v want %v", stored.Step, tt.step)
+			}
+			if stored.Retryable != tt.retryable {
+				t.Errorf("unexpected retryability: got %v want %v", stored.Retryable, tt.retryable)
+			}
+			for _, target := range tt.is {
+				if !errors.Is(restored, target) {
+					t.Errorf("restored error is not %v", target)
+				}
+			}
+			for _, target := range tt.isNot {
+				if errors.Is(restored, target) {
+					t.Errorf("restored error is unexpectedly %v", target)
+				}
+			}
+
+			again := NewErrorEnvelope(restored)
+			if again.Type != envelope.Type || len(again.Chain) != len(envelope.Chain) {
+				t.Errorf("unexpected envelope of the restored error: got %+v want %+v", again, envelope)
+			}
+		})
+	}
+}
+
+func TestStoredPipelineResult(t *testing.T) {
+	db := NewMemDB(&sync.Map{})
+	blocking := func(ctx context.Context, _ string, _ Result[string]) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	first := TaskBuilder("first", NewTaskFunc(context.Background(), "args", testTaskFn)).
+		Database(db).
+		Build()
+	second := TaskBuilder("second", NewTaskFuncWithPreviousResult(context.Background(), "args", blocking)).
+		Timeout(10 * time.Millisecond).
+		RetryIf(func(err error) bool { return !errors.Is(err, ErrTaskTimedOut) }).
+		Build()
+	p, err := NewPipeline("uuid", first, second)
+	if err != nil {
+		t.Fatalf("NewPipeline returned unexpected error: %v", err)
+	}
+
+	p.Exec(context.Background())
+	if err := p.Write(); err != nil {
+		t.Fatalf("unexpected error writing the result: %v", err)
+	}
+
+	stored, err := ReadResult[string](db, "first")
+	if err != nil {
+		t.Fatalf("unexpected error reading the stored result: %v", err)
+	}
+	if !errors.Is(stored.Err, ErrTaskTimedOut) || !errors.Is(stored.Err, context.DeadlineExceeded) {
+		t.Errorf("unexpected stored error: got %v want %v", stored.Err, ErrTaskTimedOut)
+	}
+	var storedErr *StoredError
+	if !errors.As(stored.Err, &storedErr) || storedErr.Step != 2 {
+		t.Fatalf("unexpected step of the stored error: got %+v want %v", storedErr, 2)
+	}
+	// the failed step's own predicate judges the error
+	if storedErr.Retryable {
+		t.Error("stored error is retryable despite the step's predicate")
+	}
+	if NewErrorEnvelope(stored.Err).Retryable {
+		t.Error("restored error lost its retryability")
+	}
+	if stored.Metadata.Status != TaskStatusTimedOut {
+		t.Errorf("unexpected stored status: got %v want %v", stored.Metadata.Status, TaskStatusTimedOut)
+	}
+}
@@ -0,0 +1,63 @@
+package iocast
+
+import (
+	"sync"
+)
+
+// future holds the result of a task and delivers it to any number of consumers,
+// no matter if they subscribe before or after it is resolved.
+type future[T any] struct {
+	mu          sync.Mutex
+	done        chan struct{}
+	resolved    bool
+	result      Result[T]
+	subscribers []chan Result[T]
+}
+
+func newFuture[T any]() *future[T] {
+	return &future[T]{
+		done: make(chan struct{}),
+	}
+}
+
+// resolve sets the result and delivers it to the subscribers. Only the first call has any effect.
+func (f *future[T]) resolve(result Result[T]) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.resolved {
+		return false
+	}
+	f.resolved = true
+	f.result = result
+	for _, ch := range f.subscribers {
+		ch <- result
+		close(ch)
+	}
+	f.subscribers = nil
+	close(f.done)
+	return true
+}
+
+// subscribe returns a channel that receives the result once it is resolved. The channels
+// of the subscriptions made before then are kept until the result is resolved.
+func (f *future[T]) subscribe() <-chan Result[T] {
+	ch := make(chan Result[T], 1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.resolved {
+		ch <- f.result
+		close(ch)
+		return ch
+	}
+	f.subscribers = append(f.subscribers, ch)
+	return ch
+}
+
+// wait blocks until the result is resolved and returns it.
+func (f *future[T]) wait() Result[T] {
+	<-f.done
+	return f.result
+}
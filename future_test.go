@@ -0,0 +1,76 @@
+package iocast
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFuture(t *testing.T) {
+	f := newFuture[string]()
+
+	early := []<-chan Result[string]{f.subscribe(), f.subscribe()}
+
+	if ok := f.resolve(Result[string]{Out: "first"}); !ok {
+		t.Error("resolve did not resolve the future")
+	}
+	if ok := f.resolve(Result[string]{Out: "second"}); ok {
+		t.Error("resolve resolved the future twice")
+	}
+
+	late := f.subscribe()
+	for _, ch := range append(early, late) {
+		result := <-ch
+		if result.Out != "first" {
+			t.Errorf("unexpected result out: got %v want %v", result.Out, "first")
+		}
+	}
+	if result := f.wait(); result.Out != "first" {
+		t.Errorf("unexpected result out: got %v want %v", result.Out, "first")
+	}
+}
+
+func TestTaskResultConsumers(t *testing.T) {
+	p := NewWorkerPool(1, 1)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	db := NewMemDB(&sync.Map{})
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	task := TaskBuilder("uuid", taskFn).Database(db).Build()
+
+	waiters := []<-chan Result[string]{task.Wait(), task.Wait()}
+	p.Enqueue(task)
+
+	for _, ch := range waiters {
+		select {
+		case result := <-ch:
+			if result.Out != "args" {
+				t.Errorf("unexpected result out: got %v want %v", result.Out, "args")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result was not delivered to every consumer")
+		}
+	}
+
+	<-task.Done()
+	if result := <-task.Wait(); result.Out != "args" {
+		t.Errorf("unexpected late result out: got %v want %v", result.Out, "args")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		stored, err := ReadResult[string](db, "uuid")
+		if err == nil {
+			if stored.Out != "args" || stored.Metadata.Status != TaskStatusSuccess {
+				t.Errorf("unexpected stored result: got %v, %v want %v, %v", stored.Out, stored.Metadata.Status, "args", TaskStatusSuccess)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("result was not written to the database")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
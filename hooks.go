@@ -0,0 +1,144 @@
+package iocast
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// hookTimeout is how long a worker waits for a hook before moving on without it.
+const hookTimeout = 5 * time.Second
+
+// runHook runs a hook isolated from the worker. A panicking hook is recovered and
+// a blocked one is abandoned after hookTimeout, so hooks can neither crash nor
+// deadlock the worker, e.g. by stopping the pool they are running in.
+func runHook(name string, fn func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("recovered from panic in %s hook: %v", name, r)
+			}
+		}()
+		fn()
+	}()
+
+	timer := time.NewTimer(hookTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Printf("%s hook did not return within %v, moving on", name, hookTimeout)
+	}
+}
+
+type taskHooks[T any] struct {
+	onStart    []func(Metadata)
+	onRetry    []func(attempt int, err error)
+	onSuccess  []func(Result[T])
+	onFailure  []func(Result[T])
+	onComplete []func(Result[T])
+}
+
+type poolHooks struct {
+	mu         sync.RWMutex
+	onStart    []func(Job)
+	onRetry    []func(j Job, attempt int, err error)
+	onSuccess  []func(Job, Result[any])
+	onFailure  []func(Job, Result[any])
+	onComplete []func(Job, Result[any])
+}
+
+type execEnvKey struct{}
+
+// execEnv carries the worker pool's extensions down to the job it executes.
+type execEnv struct {
+	job        Job
+	workerID   int
+	hooks      *poolHooks
+	middleware []Middleware
+	// completed and err are the outcome of the job, once it has reported it.
+	completed bool
+	err       error
+}
+
+func withExecEnv(ctx context.Context, env *execEnv) context.Context {
+	return context.WithValue(ctx, execEnvKey{}, env)
+}
+
+func execEnvFrom(ctx context.Context) *execEnv {
+	env, _ := ctx.Value(execEnvKey{}).(*execEnv)
+	return env
+}
+
+// jobStarted runs the pool's OnStart hooks for the job being executed.
+func jobStarted(env *execEnv) {
+	if env == nil {
+		return
+	}
+	env.hooks.mu.RLock()
+	hooks := env.hooks.onStart
+	env.hooks.mu.RUnlock()
+	for _, fn := range hooks {
+		runHook("OnStart", func() { fn(env.job) })
+	}
+}
+
+func (t *Task[T]) started() {
+	m := t.Metadata()
+	for _, fn := range t.hooks.onStart {
+		runHook("OnStart", func() { fn(m) })
+	}
+}
+
+func (t *Task[T]) retrying(env *execEnv, attempt int, err error) {
+	for _, fn := range t.hooks.onRetry {
+		runHook("OnRetry", func() { fn(attempt, err) })
+	}
+	if env == nil {
+		return
+	}
+	env.hooks.mu.RLock()
+	hooks := env.hooks.onRetry
+	env.hooks.mu.RUnlock()
+	for _, fn := range hooks {
+		runHook("OnRetry", func() { fn(env.job, attempt, err) })
+	}
+}
+
+func (t *Task[T]) completed(env *execEnv, result Result[T]) {
+	hooks := t.hooks.onFailure
+	if result.Err == nil {
+		hooks = t.hooks.onSuccess
+	}
+	for _, hooks := range [][]func(Result[T]){hooks, t.hooks.onComplete} {
+		for _, fn := range hooks {
+			runHook("completion", func() { fn(result) })
+		}
+	}
+	jobCompleted(env, result.untyped())
+}
+
+// jobCompleted runs the pool's completion hooks for the job being executed.
+func jobCompleted(env *execEnv, result Result[any]) {
+	if env == nil {
+		return
+	}
+	env.completed = true
+	env.err = result.Err
+	env.hooks.mu.RLock()
+	hooks := env.hooks.onFailure
+	if result.Err == nil {
+		hooks = env.hooks.onSuccess
+	}
+	onComplete := env.hooks.onComplete
+	env.hooks.mu.RUnlock()
+
+	for _, hooks := range [][]func(Job, Result[any]){hooks, onComplete} {
+		for _, fn := range hooks {
+			runHook("completion", func() { fn(env.job, result) })
+		}
+	}
+}
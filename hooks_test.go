@@ -0,0 +1,107 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type hookRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *hookRecorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *hookRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func TestTaskHooks(t *testing.T) {
+	r := &hookRecorder{}
+
+	attempts := 0
+	taskFn := NewTaskFunc(context.Background(), "args", func(_ context.Context, args string) (string, error) {
+		attempts++
+		if attempts == 1 {
+			return "", errors.New("something went wrong")
+		}
+		return args, nil
+	})
+
+	var task *Task[string]
+	task = TaskBuilder("uuid", taskFn).
+		OnStart(func(m Metadata) { r.record("start " + string(m.Status.(taskStatus))) }).
+		OnRetry(func(attempt int, err error) { r.record("retry " + err.Error()) }).
+		OnSuccess(func(result Result[string]) {
+			// waiting on the task from its own hook must not deadlock
+			<-task.Wait()
+			r.record("success " + result.Out)
+		}).
+		OnFailure(func(Result[string]) { r.record("failure") }).
+		OnComplete(func(Result[string]) { panic("hooks must not crash the worker") }).
+		OnComplete(func(Result[string]) { r.record("complete") }).
+		Build()
+
+	task.Exec(context.Background())
+
+	expected := []string{"start RUNNING", "retry something went wrong", "success args", "complete"}
+	events := r.recorded()
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected hook events: got %v want %v", events, expected)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("unexpected hook event: got %v want %v", events[i], expected[i])
+		}
+	}
+}
+
+func TestWorkerPoolHooks(t *testing.T) {
+	r := &hookRecorder{}
+
+	p := NewWorkerPool(1, 2)
+	p.OnStart(func(j Job) { r.record("start " + j.ID()) })
+	p.OnRetry(func(j Job, attempt int, _ error) { r.record("retry " + j.ID()) })
+	p.OnSuccess(func(j Job, _ Result[any]) { r.record("success " + j.ID()) })
+	p.OnFailure(func(j Job, result Result[any]) { r.record("failure " + j.ID() + " " + result.Err.Error()) })
+	p.OnComplete(func(j Job, _ Result[any]) { r.record("complete " + j.ID()) })
+	p.Start(context.Background())
+
+	ok := NewTaskFunc(context.Background(), "args", testTaskFn)
+	failing := NewTaskFunc(context.Background(), "args", func(_ context.Context, _ string) (string, error) {
+		return "", errors.New("boom")
+	})
+	first := TaskBuilder("first", ok).Build()
+	second := TaskBuilder("second", failing).MaxRetries(1).Build()
+	p.Enqueue(first)
+	p.Enqueue(second)
+	<-second.Wait()
+	p.Stop()
+
+	expected := []string{
+		"start first", "success first", "complete first",
+		"start second", "retry second", "failure second boom", "complete second",
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(r.recorded()) < len(expected) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	events := r.recorded()
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected hook events: got %v want %v", events, expected)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("unexpected hook event: got %v want %v", events[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package iocast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+)
+
+const (
+	// minCompactionRecords is the log size under which compaction is never triggered.
+	minCompactionRecords = 1024
+	// maxLogRecordSize is the size of the longest record a log can be read back with.
+	maxLogRecordSize = 64 * 1024 * 1024
+)
+
+// readLog calls fn with every record of the JSON lines log at path, in order. A missing
+// log holds no records. Corrupted records, e.g. a torn write at the tail of the log, are skipped.
+func readLog[R any](path string, fn func(R)) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLogRecordSize)
+	for scanner.Scan() {
+		var rec R
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("skipping corrupted record in %s: %v", path, err)
+			continue
+		}
+		fn(rec)
+	}
+	return scanner.Err()
+}
+
+// rewriteLog writes the records to a temporary file and atomically swaps it with the log at
+// path, then reopens the log for appending in place of file. It returns the file the log is
+// open with afterwards, which is still the given one if the log could not be rewritten.
+func rewriteLog[R any](path string, file *os.File, records []R) (*os.File, error) {
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return file, err
+	}
+	if err := writeLog(tmp, records); err != nil {
+		return file, errors.Join(err, tmp.Close())
+	}
+	if err := tmp.Close(); err != nil {
+		return file, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return file, err
+	}
+
+	if file != nil {
+		// The log was swapped already, the old file only holds superseded records.
+		if err := file.Close(); err != nil {
+			log.Printf("error closing the old log file of %s: %v", path, err)
+		}
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+}
+
+// writeLog writes the records to the file as JSON lines and syncs it to disk.
+func writeLog[R any](f *os.File, records []R) error {
+	w := bufio.NewWriter(f)
+	for _, rec := range records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
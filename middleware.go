@@ -0,0 +1,46 @@
+package iocast
+
+import (
+	"context"
+	"sync"
+)
+
+// AttemptInfo describes the attempt of a task a middleware wraps.
+type AttemptInfo struct {
+	TaskID   string
+	Attempt  int
+	Metadata Metadata
+}
+
+// Handler runs an attempt of a task and returns its error.
+type Handler func(ctx context.Context, info AttemptInfo) error
+
+// Middleware wraps the handler of every attempt of a task, like HTTP middleware
+// wraps handlers. It may change the context passed down the chain, inspect or
+// replace the returned error, or return early without calling next at all.
+type Middleware func(next Handler) Handler
+
+// chain wraps the handler so that the first middleware is the outermost one.
+func chain(h Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+type middlewareChain struct {
+	mu         sync.RWMutex
+	middleware []Middleware
+}
+
+func (c *middlewareChain) use(middleware ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middleware = append(c.middleware, middleware...)
+}
+
+func (c *middlewareChain) snapshot() []Middleware {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.middleware[:len(c.middleware):len(c.middleware)]
+}
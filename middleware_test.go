@@ -0,0 +1,89 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := &hookRecorder{}
+
+	tracing := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, info AttemptInfo) error {
+				r.record(fmt.Sprintf("%s before %s#%d", name, info.TaskID, info.Attempt))
+				err := next(ctx, info)
+				r.record(fmt.Sprintf("%s after %v", name, err))
+				return err
+			}
+		}
+	}
+	auth := func(next Handler) Handler {
+		return func(ctx context.Context, info AttemptInfo) error {
+			return next(context.WithValue(ctx, testContextKey("user"), "admin"), info)
+		}
+	}
+
+	attempts := 0
+	taskFn := NewTaskFunc(context.Background(), "args", func(ctx context.Context, _ string) (string, error) {
+		attempts++
+		if attempts == 1 {
+			return "", errors.New("boom")
+		}
+		return ctx.Value(testContextKey("user")).(string), nil
+	})
+	task := TaskBuilder("uuid", taskFn).Use(tracing("task"), auth).Build()
+
+	p := NewWorkerPool(1, 1)
+	p.Use(tracing("pool"))
+	p.Start(context.Background())
+	defer p.Stop()
+
+	p.Enqueue(task)
+	result := <-task.Wait()
+
+	if result.Out != "admin" {
+		t.Errorf("middleware did not inject the context value: got %v want %v", result.Out, "admin")
+	}
+	expected := []string{
+		"pool before uuid#1", "task before uuid#1", "task after boom", "pool after boom",
+		"pool before uuid#2", "task before uuid#2", "task after <nil>", "pool after <nil>",
+	}
+	events := r.recorded()
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected middleware events: got %v want %v", events, expected)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("unexpected middleware event: got %v want %v", events[i], expected[i])
+		}
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	errUnauthorized := errors.New("unauthorized")
+	deny := func(next Handler) Handler {
+		return func(context.Context, AttemptInfo) error {
+			return Permanent(errUnauthorized)
+		}
+	}
+
+	executed := false
+	taskFn := NewTaskFunc(context.Background(), "args", func(_ context.Context, args string) (string, error) {
+		executed = true
+		return args, nil
+	})
+	task := TaskBuilder("uuid", taskFn).MaxRetries(3).Use(deny).Build()
+
+	task.Exec(context.Background())
+	result := <-task.Wait()
+
+	if executed {
+		t.Error("task func was executed despite the middleware returning early")
+	}
+	if !errors.Is(result.Err, errUnauthorized) {
+		t.Errorf("unexpected result error: got %v want %v", result.Err, errUnauthorized)
+	}
+}
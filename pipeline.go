@@ -3,6 +3,7 @@ package iocast
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 const (
@@ -10,9 +11,8 @@ const (
 )
 
 type Pipeline[T any] struct {
-	id         string
-	head       *Task[T]
-	resultChan chan Result[T]
+	id   string
+	head *Task[T]
 }
 
 // NewPipeline links tasks together to execute them in order, returns a pipeline instance.
@@ -27,15 +27,21 @@ func NewPipeline[T any](id string, tasks ...*Task[T]) (*Pipeline[T], error) {
 		}
 	}
 	return &Pipeline[T]{
-		id:         id,
-		head:       head,
-		resultChan: head.resultChan,
+		id:   id,
+		head: head,
 	}, nil
 }
 
 // Wait awaits for the final result of the pipeline (last task in the order).
+// It can be called any number of times, before or after the result is ready. As with
+// Task.Wait, callers that poll the pipeline should do so with Done.
 func (p *Pipeline[T]) Wait() <-chan Result[T] {
-	return p.head.resultChan
+	return p.head.Wait()
+}
+
+// Done returns a channel that is closed when the result of the pipeline is ready.
+func (p *Pipeline[T]) Done() <-chan struct{} {
+	return p.head.Done()
 }
 
 // Exec executes the linked tasks of the pipeline.
@@ -43,6 +49,11 @@ func (p *Pipeline[T]) Exec(ctx context.Context) {
 	p.head.Exec(ctx)
 }
 
+// Cancel cancels the pipeline. A running pipeline stops before its next task.
+func (p *Pipeline[T]) Cancel() {
+	p.head.Cancel()
+}
+
 // Write stores the results of the pipeline (head's result) to the database.
 func (p *Pipeline[T]) Write() error {
 	return p.head.Write()
@@ -53,9 +64,25 @@ func (p *Pipeline[T]) ID() string {
 	return p.id
 }
 
+func (p *Pipeline[T]) markEnqueued(now time.Time) {
+	p.head.markEnqueued(now)
+}
+
+func (p *Pipeline[T]) priority() int {
+	return p.head.priority()
+}
+
+func (p *Pipeline[T]) queueName() string {
+	return p.head.queueName()
+}
+
+func (p *Pipeline[T]) applyRetryDefaults(maxRetries int, policy RetryPolicy) {
+	p.head.applyRetryDefaults(maxRetries, policy)
+}
+
 // Metadata is a metadata getter.
 func (p *Pipeline[T]) Metadata() Metadata {
 	p.head.mu.Lock()
 	defer p.head.mu.Unlock()
-	return p.head.metadata
+	return p.head.metadata.clone()
 }
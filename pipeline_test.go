@@ -2,6 +2,7 @@ package iocast
 
 import (
 	"context"
+	"errors"
 	"testing"
 )
 
@@ -33,6 +34,13 @@ func TestPipeline(t *testing.T) {
 	if result.Out != expected {
 		t.Errorf("Wait returned unexpected result output: got %v want %v", result.Out, expected)
 	}
+	var steps []int
+	for _, a := range result.Metadata.Attempts {
+		steps = append(steps, a.Step)
+	}
+	if len(steps) != 2 || steps[0] != 1 || steps[1] != 2 {
+		t.Errorf("unexpected steps of the attempts: got %v want %v", steps, []int{1, 2})
+	}
 }
 
 func TestPipelineWithLessThanTwoTasks(t *testing.T) {
@@ -49,3 +57,39 @@ func TestPipelineWithLessThanTwoTasks(t *testing.T) {
 		t.Errorf("NewPipeline returned unexpected error: got %v want %v", err.Error(), expectedMsg)
 	}
 }
+
+func TestPipelineCancel(t *testing.T) {
+	args := "test"
+
+	var p *Pipeline[string]
+	taskFn := NewTaskFunc(context.Background(), args, func(_ context.Context, args string) (string, error) {
+		p.Cancel()
+		return args, nil
+	})
+	task := TaskBuilder("head", taskFn).Build()
+
+	executed := false
+	taskPipedFn := NewTaskFuncWithPreviousResult(context.Background(), args, func(_ context.Context, args string, _ Result[string]) (string, error) {
+		executed = true
+		return args, nil
+	})
+	pipedTask := TaskBuilder("second", taskPipedFn).Build()
+
+	p, err := NewPipeline("id", task, pipedTask)
+	if err != nil {
+		t.Fatalf("NewPipeline returned unexpected error: %v", err)
+	}
+
+	p.Exec(context.Background())
+
+	result := <-p.Wait()
+	if executed {
+		t.Error("the pipeline did not stop after being cancelled")
+	}
+	if !errors.Is(result.Err, ErrTaskCancelled) {
+		t.Errorf("Wait returned unexpected result error: got %v want %v", result.Err, ErrTaskCancelled)
+	}
+	if p.Metadata().Status != TaskStatusCancelled {
+		t.Errorf("unexpected status: got %v want %v", p.Metadata().Status, TaskStatusCancelled)
+	}
+}
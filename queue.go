@@ -0,0 +1,261 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultAgingInterval is how long a job waits in a MemQueue before it is raised by one priority level.
+	defaultAgingInterval = time.Second
+)
+
+var (
+	ErrQueueFull   = errors.New("queue is full")
+	ErrQueueClosed = errors.New("queue is closed")
+)
+
+// Queue is a backend holding the jobs waiting to be executed by a worker pool.
+type Queue interface {
+	// Push adds a job to the queue or returns ErrQueueFull if it has no capacity left.
+	Push(Job) error
+	// Pop blocks until a job is available. Once the queue is closed, it keeps
+	// returning the remaining jobs and then ErrQueueClosed.
+	Pop(ctx context.Context) (Job, error)
+	// Start records that a popped job has started executing.
+	Start(Job) error
+	// Ack records that a popped job has finished executing.
+	Ack(Job) error
+	// Len returns the number of jobs waiting in the queue.
+	Len() int
+	// Close stops the queue from accepting new jobs.
+	Close() error
+}
+
+// MemQueue is an in-memory priority queue with a fixed capacity. Jobs of higher
+// priority are popped first and jobs of the same priority in FIFO order. To keep
+// a flood of urgent jobs from starving the rest, waiting jobs are aged: each
+// aging interval a job waits raises its priority by one level.
+type MemQueue struct {
+	mu       sync.Mutex
+	levels   map[int][]queuedJob
+	size     int
+	capacity int
+	aging    time.Duration
+	waiters  int
+	closed   bool
+	notEmpty chan struct{}
+	notFull  chan struct{}
+}
+
+// queuedJob is a job waiting in a MemQueue along with the time it was pushed.
+type queuedJob struct {
+	job Job
+	at  time.Time
+}
+
+// NewMemQueue creates and returns a new in-memory queue that ages jobs every second.
+func NewMemQueue(capacity int) *MemQueue {
+	return NewMemQueueWithAging(capacity, defaultAgingInterval)
+}
+
+// NewMemQueueWithAging creates and returns a new in-memory queue that raises the priority
+// of waiting jobs every aging interval. A non-positive interval disables aging, so that
+// jobs are strictly popped by priority.
+func NewMemQueueWithAging(capacity int, aging time.Duration) *MemQueue {
+	return &MemQueue{
+		levels:   make(map[int][]queuedJob),
+		capacity: capacity,
+		aging:    aging,
+		notEmpty: make(chan struct{}),
+	}
+}
+
+// Push adds a job to the back of its priority level. Like a buffered channel, a job is
+// accepted beyond the capacity if a consumer is already waiting for it.
+func (q *MemQueue) Push(j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.size >= q.capacity+q.waiters {
+		return ErrQueueFull
+	}
+	q.add(j)
+	return nil
+}
+
+// accepts returns the error Push would return for a new job, if any.
+func (q *MemQueue) accepts() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.size >= q.capacity+q.waiters {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// push adds a job regardless of the queue's capacity.
+func (q *MemQueue) push(j Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.add(j)
+}
+
+// add adds a job to its priority level, must be called with the lock held.
+func (q *MemQueue) add(j Job) {
+	priority := jobPriority(j)
+	q.levels[priority] = append(q.levels[priority], queuedJob{job: j, at: time.Now()})
+	q.size++
+	q.signal()
+}
+
+// next removes and returns the job with the highest aged priority, or the one that
+// waited the longest among equals. It must be called with the lock held on a non-empty queue.
+func (q *MemQueue) next() Job {
+	now := time.Now()
+	var (
+		best      int
+		bestScore int
+		bestAt    time.Time
+		found     bool
+	)
+	for priority, jobs := range q.levels {
+		// The head of a level is its oldest job, so it has the highest aged priority.
+		head := jobs[0]
+		score := priority
+		if q.aging > 0 {
+			score += int(now.Sub(head.at) / q.aging)
+		}
+		if !found || score > bestScore || score == bestScore && head.at.Before(bestAt) {
+			best, bestScore, bestAt, found = priority, score, head.at, true
+		}
+	}
+
+	jobs := q.levels[best]
+	j := jobs[0].job
+	jobs[0] = queuedJob{}
+	if len(jobs) == 1 {
+		delete(q.levels, best)
+	} else {
+		q.levels[best] = jobs[1:]
+	}
+	q.size--
+	return j
+}
+
+// signal wakes up the consumers waiting on the queue, must be called with the lock held.
+func (q *MemQueue) signal() {
+	if q.waiters > 0 {
+		close(q.notEmpty)
+		q.notEmpty = make(chan struct{})
+	}
+}
+
+// space returns a channel that is closed the next time the queue may have room for a job.
+func (q *MemQueue) space() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.notFull == nil {
+		q.notFull = make(chan struct{})
+	}
+	return q.notFull
+}
+
+// signalSpace wakes up the producers waiting for room in the queue, must be called with the lock held.
+func (q *MemQueue) signalSpace() {
+	if q.notFull != nil {
+		close(q.notFull)
+		q.notFull = nil
+	}
+}
+
+// Pop removes and returns the job of the highest priority, aging included.
+func (q *MemQueue) Pop(ctx context.Context) (Job, error) {
+	q.mu.Lock()
+	for q.size == 0 {
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrQueueClosed
+		}
+		notEmpty := q.notEmpty
+		q.waiters++
+		// A waiting consumer makes room for a job, like in an unbuffered channel.
+		q.signalSpace()
+		q.mu.Unlock()
+
+		select {
+		case <-notEmpty:
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.waiters--
+			q.mu.Unlock()
+			return nil, ctx.Err()
+		}
+
+		q.mu.Lock()
+		q.waiters--
+	}
+	j := q.next()
+	q.signalSpace()
+	q.mu.Unlock()
+	return j, nil
+}
+
+// Start is a no-op, in-memory jobs do not outlive the process.
+func (q *MemQueue) Start(Job) error {
+	return nil
+}
+
+// Ack is a no-op, in-memory jobs do not outlive the process.
+func (q *MemQueue) Ack(Job) error {
+	return nil
+}
+
+// Len returns the number of jobs waiting in the queue.
+func (q *MemQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Depth returns the number of jobs waiting at each priority.
+func (q *MemQueue) Depth() map[int]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	depth := make(map[int]int, len(q.levels))
+	for priority, jobs := range q.levels {
+		depth[priority] = len(jobs)
+	}
+	return depth
+}
+
+// drained reports whether the queue is closed and has no jobs left.
+func (q *MemQueue) drained() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed && q.size == 0
+}
+
+// Close stops the queue from accepting new jobs and wakes up any waiting consumers.
+func (q *MemQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.notEmpty)
+	q.notEmpty = make(chan struct{})
+	q.signalSpace()
+	return nil
+}
@@ -0,0 +1,282 @@
+package iocast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	queueOpEnqueue = "enqueue"
+	queueOpStart   = "start"
+	queueOpAck     = "ack"
+)
+
+type queueRecord struct {
+	Op  string `json:"op"`
+	Seq uint64 `json:"seq"`
+	Job []byte `json:"job,omitempty"`
+}
+
+// FileQueue is a durable queue backed by a write-ahead log file. Every enqueued
+// job is synced to disk before it is accepted, and the jobs that were not
+// acknowledged when the process stopped are replayed through the registry
+// the next time the queue is opened.
+type FileQueue struct {
+	mu       sync.Mutex
+	path     string
+	registry *Registry
+	file     *os.File
+	mem      *MemQueue
+	seq      uint64
+	pending  map[Job]uint64
+	// encoded holds the records of the unacknowledged jobs, including the ones the
+	// registry could not decode, so that compaction keeps them in the log.
+	encoded map[uint64][]byte
+	// inflight counts the consumers popping a job and the popped jobs not acknowledged yet.
+	inflight int
+	records  int
+}
+
+// NewFileQueue opens the queue log at path, creating it if needed, and restores the unacknowledged jobs it holds.
+func NewFileQueue(path string, capacity int, registry *Registry) (*FileQueue, error) {
+	q := &FileQueue{
+		path:     path,
+		registry: registry,
+		mem:      NewMemQueue(capacity),
+		pending:  make(map[Job]uint64),
+		encoded:  make(map[uint64][]byte),
+	}
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *FileQueue) replay() error {
+	unacked := make(map[uint64][]byte)
+	err := readLog(q.path, func(rec queueRecord) {
+		if rec.Seq > q.seq {
+			q.seq = rec.Seq
+		}
+		switch rec.Op {
+		case queueOpEnqueue:
+			unacked[rec.Seq] = rec.Job
+		case queueOpAck:
+			delete(unacked, rec.Seq)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	seqs := make([]uint64, 0, len(unacked))
+	for seq := range unacked {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	for _, seq := range seqs {
+		// Jobs that cannot be decoded, e.g. because their handler is not registered
+		// by this process, stay in the log for a process that can run them.
+		q.encoded[seq] = unacked[seq]
+		j, err := q.registry.DecodeJob(unacked[seq])
+		if err != nil {
+			log.Printf("skipping queued job %d: %v", seq, err)
+			continue
+		}
+		q.pending[j] = seq
+		// Replayed jobs were accepted before, so they are not subject to the capacity.
+		q.mem.push(j)
+	}
+	return nil
+}
+
+// Push persists the job and adds it to the queue. Only jobs created by a registry can be persisted.
+func (q *FileQueue) Push(j Job) error {
+	data, err := q.registry.EncodeJob(j)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.file == nil {
+		return ErrQueueClosed
+	}
+	// Check the capacity first so that rejected jobs are not written to the log.
+	if err := q.mem.accepts(); err != nil {
+		return err
+	}
+	q.seq++
+	seq := q.seq
+	if err := q.append(queueRecord{Op: queueOpEnqueue, Seq: seq, Job: data}, true); err != nil {
+		return err
+	}
+	q.pending[j] = seq
+	q.encoded[seq] = data
+	if err := q.mem.Push(j); err != nil {
+		// The queue filled up or closed meanwhile, discard the job from the log.
+		delete(q.pending, j)
+		delete(q.encoded, seq)
+		if ackErr := q.append(queueRecord{Op: queueOpAck, Seq: seq}, false); ackErr != nil {
+			log.Printf("error discarding job %s from the queue log: %v", j.ID(), ackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Pop removes and returns the job at the front of the queue.
+func (q *FileQueue) Pop(ctx context.Context) (Job, error) {
+	// Count the job as in flight before popping it, so that Close cannot
+	// close the log between the pop and the job's Start and Ack.
+	q.mu.Lock()
+	q.inflight++
+	q.mu.Unlock()
+
+	j, err := q.mem.Pop(ctx)
+	if err != nil {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.inflight--
+		if closeErr := q.closeIfDrained(); closeErr != nil {
+			log.Printf("error closing the queue log: %v", closeErr)
+		}
+		return nil, err
+	}
+	return j, nil
+}
+
+// space returns a channel that is closed the next time the queue may have room for a job.
+func (q *FileQueue) space() <-chan struct{} {
+	return q.mem.space()
+}
+
+// Start records that the job has started executing.
+func (q *FileQueue) Start(j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seq, ok := q.pending[j]
+	if !ok {
+		return fmt.Errorf("job %s is not queued", j.ID())
+	}
+	if q.file == nil {
+		return ErrQueueClosed
+	}
+	return q.append(queueRecord{Op: queueOpStart, Seq: seq}, true)
+}
+
+// Ack records that the job has finished executing so it is not replayed.
+func (q *FileQueue) Ack(j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seq, ok := q.pending[j]
+	if !ok {
+		return fmt.Errorf("job %s is not queued", j.ID())
+	}
+	if q.file == nil {
+		return ErrQueueClosed
+	}
+	if err := q.append(queueRecord{Op: queueOpAck, Seq: seq}, true); err != nil {
+		return err
+	}
+	delete(q.pending, j)
+	delete(q.encoded, seq)
+	q.inflight--
+
+	if q.records >= minCompactionRecords && q.records > 2*len(q.encoded) {
+		if err := q.compact(); err != nil {
+			return err
+		}
+	}
+	return q.closeIfDrained()
+}
+
+// release gives back a popped job without acknowledging it, so that it is replayed the next time the queue is opened.
+func (q *FileQueue) release(j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.pending[j]; !ok {
+		return fmt.Errorf("job %s is not queued", j.ID())
+	}
+	q.inflight--
+	return q.closeIfDrained()
+}
+
+// Len returns the number of jobs waiting in the queue.
+func (q *FileQueue) Len() int {
+	return q.mem.Len()
+}
+
+// Depth returns the number of jobs waiting at each priority.
+func (q *FileQueue) Depth() map[int]int {
+	return q.mem.Depth()
+}
+
+// Close stops the queue from accepting new jobs. The log is closed once the remaining jobs have been acknowledged.
+func (q *FileQueue) Close() error {
+	q.mem.Close()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closeIfDrained()
+}
+
+func (q *FileQueue) closeIfDrained() error {
+	if q.file == nil || !q.mem.drained() || q.inflight > 0 {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+func (q *FileQueue) append(rec queueRecord, sync bool) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := q.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	q.records++
+	if sync {
+		return q.file.Sync()
+	}
+	return nil
+}
+
+// compact rewrites the log so it only holds the jobs that have not been acknowledged.
+func (q *FileQueue) compact() error {
+	seqs := make([]uint64, 0, len(q.encoded))
+	for seq := range q.encoded {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	records := make([]queueRecord, 0, len(seqs))
+	for _, seq := range seqs {
+		records = append(records, queueRecord{Op: queueOpEnqueue, Seq: seq, Job: q.encoded[seq]})
+	}
+	file, err := rewriteLog(q.path, q.file, records)
+	q.file = file
+	if err != nil {
+		return err
+	}
+	q.records = len(records)
+	return nil
+}
@@ -0,0 +1,315 @@
+package iocast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+
+	r := NewRegistry(JSONCodec)
+	if err := Register(r, "repeat", testRepeatFn); err != nil {
+		t.Fatalf("Register returned unexpected error: %v", err)
+	}
+
+	q, err := NewFileQueue(path, 4, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+
+	for _, id := range []string{"acked", "started", "pending"} {
+		env, err := r.Envelope(id, "repeat", testRegistryArgs{Text: id, Times: 1})
+		if err != nil {
+			t.Fatalf("Envelope returned unexpected error: %v", err)
+		}
+		if err := q.Push(mustNewJob(t, r, env)); err != nil {
+			t.Fatalf("Push returned unexpected error: %v", err)
+		}
+	}
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	err = q.Push(TaskBuilder("closure", taskFn).Build())
+	if !errors.Is(err, ErrTaskNotSerializable) {
+		t.Errorf("Push returned unexpected error: got %v want %v", err, ErrTaskNotSerializable)
+	}
+
+	acked, _ := q.Pop(context.Background())
+	q.Start(acked)
+	if err := q.Ack(acked); err != nil {
+		t.Fatalf("Ack returned unexpected error: %v", err)
+	}
+	started, _ := q.Pop(context.Background())
+	if err := q.Start(started); err != nil {
+		t.Fatalf("Start returned unexpected error: %v", err)
+	}
+
+	// Simulate a crash by reopening the log without closing the queue.
+	q, err = NewFileQueue(path, 4, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	defer q.Close()
+
+	if q.Len() != 2 {
+		t.Fatalf("replayed queue has unexpected length: got %v want %v", q.Len(), 2)
+	}
+	for _, expected := range []string{"started", "pending"} {
+		j, err := q.Pop(context.Background())
+		if err != nil {
+			t.Fatalf("Pop returned unexpected error: %v", err)
+		}
+		if j.ID() != expected {
+			t.Errorf("Pop returned unexpected job: got %v want %v", j.ID(), expected)
+		}
+
+		task, ok := j.(*Task[string])
+		if !ok {
+			t.Fatalf("Pop returned unexpected job type: %T", j)
+		}
+		task.Exec(context.Background())
+		result := <-task.Wait()
+		if result.Out != expected {
+			t.Errorf("replayed job returned unexpected output: got %v want %v", result.Out, expected)
+		}
+		if err := q.Ack(j); err != nil {
+			t.Fatalf("Ack returned unexpected error: %v", err)
+		}
+	}
+}
+
+func TestFileQueueUndecodableJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+
+	r := NewRegistry(JSONCodec)
+	if err := Register(r, "repeat", testRepeatFn); err != nil {
+		t.Fatalf("Register returned unexpected error: %v", err)
+	}
+	q, err := NewFileQueue(path, 1, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	env, _ := r.Envelope("uuid", "repeat", testRegistryArgs{Text: "a", Times: 1})
+	if err := q.Push(mustNewJob(t, r, env)); err != nil {
+		t.Fatalf("Push returned unexpected error: %v", err)
+	}
+
+	// jobs rejected by a full queue are not written to the log
+	info, _ := os.Stat(path)
+	env, _ = r.Envelope("full", "repeat", testRegistryArgs{Text: "b", Times: 1})
+	if err := q.Push(mustNewJob(t, r, env)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Push returned unexpected error: got %v want %v", err, ErrQueueFull)
+	}
+	if after, _ := os.Stat(path); after.Size() != info.Size() {
+		t.Errorf("unexpected log size after a rejected push: got %v want %v", after.Size(), info.Size())
+	}
+
+	// a process without the handler keeps the job in the log
+	q, err = NewFileQueue(path, 1, NewRegistry(JSONCodec))
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	if q.Len() != 0 {
+		t.Errorf("replayed queue has unexpected length: got %v want %v", q.Len(), 0)
+	}
+	q.Close()
+
+	q, err = NewFileQueue(path, 1, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	defer q.Close()
+	if q.Len() != 1 {
+		t.Errorf("replayed queue has unexpected length: got %v want %v", q.Len(), 1)
+	}
+}
+
+func TestFileQueueCompactionWithUndecodableJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected error creating the log: %v", err)
+	}
+	for seq := range uint64(minCompactionRecords + 100) {
+		job, _ := json.Marshal(TaskEnvelope{ID: "unknown", Name: "unknown"})
+		data, _ := json.Marshal(queueRecord{Op: queueOpEnqueue, Seq: seq + 1, Job: job})
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			t.Fatalf("unexpected error writing the log: %v", err)
+		}
+	}
+	f.Close()
+
+	r := NewRegistry(JSONCodec)
+	if err := Register(r, "repeat", testRepeatFn); err != nil {
+		t.Fatalf("Register returned unexpected error: %v", err)
+	}
+	q, err := NewFileQueue(path, 1, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	defer q.Close()
+
+	// the undecodable jobs are live records, acknowledging the others does not compact the log
+	for i := range 10 {
+		env, _ := r.Envelope(fmt.Sprint(i), "repeat", testRegistryArgs{Text: "a", Times: 1})
+		if err := q.Push(mustNewJob(t, r, env)); err != nil {
+			t.Fatalf("Push returned unexpected error: %v", err)
+		}
+		j, err := q.Pop(context.Background())
+		if err != nil {
+			t.Fatalf("Pop returned unexpected error: %v", err)
+		}
+		if err := q.Ack(j); err != nil {
+			t.Fatalf("Ack returned unexpected error: %v", err)
+		}
+	}
+	if q.records != minCompactionRecords+100+20 {
+		t.Errorf("unexpected number of records: got %v want %v", q.records, minCompactionRecords+100+20)
+	}
+}
+
+func TestWorkerPoolWithFileQueue(t *testing.T) {
+	r := NewRegistry(JSONCodec)
+	if err := Register(r, "repeat", testRepeatFn); err != nil {
+		t.Fatalf("Register returned unexpected error: %v", err)
+	}
+
+	q, err := NewFileQueue(filepath.Join(t.TempDir(), "queue.log"), 1, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+
+	p := NewWorkerPoolWithQueue(1, q)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	env, _ := r.Envelope("uuid", "repeat", testRegistryArgs{Text: "a", Times: 2})
+	task, err := NewRegisteredTask[string](context.Background(), r, env)
+	if err != nil {
+		t.Fatalf("NewRegisteredTask returned unexpected error: %v", err)
+	}
+
+	if err := p.Enqueue(task); err != nil {
+		t.Fatalf("Enqueue returned unexpected error: %v", err)
+	}
+	result := <-task.Wait()
+	if result.Out != "aa" {
+		t.Errorf("unexpected result out: got %v want %v", result.Out, "aa")
+	}
+}
+
+func TestWorkerPoolShutdownWithFileQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+
+	r := NewRegistry(JSONCodec)
+	if err := Register(r, "repeat", testRepeatFn); err != nil {
+		t.Fatalf("Register returned unexpected error: %v", err)
+	}
+
+	q, err := NewFileQueue(path, 2, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	p := NewWorkerPoolWithQueue(1, q)
+	for _, id := range []string{"first", "second"} {
+		env, _ := r.Envelope(id, "repeat", testRegistryArgs{Text: id, Times: 1})
+		if err := p.Enqueue(mustNewJob(t, r, env)); err != nil {
+			t.Fatalf("Enqueue returned unexpected error: %v", err)
+		}
+	}
+
+	// the pool never started, so both jobs are left for the next run
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unfinished, err := p.ShutdownNow(ctx)
+	if err != nil {
+		t.Fatalf("ShutdownNow returned unexpected error: %v", err)
+	}
+	if len(unfinished) != 2 {
+		t.Fatalf("unexpected unfinished jobs: got %v want %v", unfinished, []string{"first", "second"})
+	}
+
+	q, err = NewFileQueue(path, 2, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	defer q.Close()
+	if q.Len() != 2 {
+		t.Errorf("replayed queue has unexpected length: got %v want %v", q.Len(), 2)
+	}
+}
+
+func TestWorkerPoolShutdownNowWithFileQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+
+	blocking := func(ctx context.Context, args testRegistryArgs) (string, error) {
+		if args.Text == "failed" {
+			return "", errors.New(args.Text)
+		}
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	r := NewRegistry(JSONCodec)
+	if err := Register(r, "blocking", blocking); err != nil {
+		t.Fatalf("Register returned unexpected error: %v", err)
+	}
+
+	q, err := NewFileQueue(path, 3, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	p := NewWorkerPoolWithQueue(3, q)
+	// the jobs return to their workers only once the shutdown is forced
+	release := make(chan struct{})
+	p.OnComplete(func(Job, Result[any]) { <-release })
+	p.Start(context.Background())
+	jobs := map[string]Job{}
+	for _, id := range []string{"cut-short", "failed", "cancelled"} {
+		env, _ := r.Envelope(id, "blocking", testRegistryArgs{Text: id})
+		j := mustNewJob(t, r, env)
+		if err := p.Enqueue(j); err != nil {
+			t.Fatalf("Enqueue returned unexpected error: %v", err)
+		}
+		jobs[id] = j
+	}
+	for id, status := range map[string]taskStatus{"cut-short": TaskStatusRunning, "failed": TaskStatusFailed, "cancelled": TaskStatusRunning} {
+		for jobs[id].Metadata().Status != status {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	p.Cancel("cancelled")
+	for jobs["cancelled"].Metadata().Status != TaskStatusCancelled {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.ShutdownNow(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ShutdownNow returned unexpected error: got %v want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	<-p.Done()
+
+	// only the job cut short by the shutdown is left for the next run
+	q, err = NewFileQueue(path, 3, r)
+	if err != nil {
+		t.Fatalf("NewFileQueue returned unexpected error: %v", err)
+	}
+	defer q.Close()
+	if q.Len() != 1 {
+		t.Fatalf("replayed queue has unexpected length: got %v want %v", q.Len(), 1)
+	}
+	j, err := q.Pop(context.Background())
+	if err != nil {
+		t.Fatalf("Pop returned unexpected error: %v", err)
+	}
+	if j.ID() != "cut-short" {
+		t.Errorf("replayed queue has unexpected job: got %v want %v", j.ID(), "cut-short")
+	}
+}
@@ -0,0 +1,140 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemQueue(t *testing.T) {
+	q := NewMemQueue(2)
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	first := TaskBuilder("first", taskFn).Build()
+	second := TaskBuilder("second", taskFn).Build()
+	third := TaskBuilder("third", taskFn).Build()
+
+	if err := q.Push(first); err != nil {
+		t.Fatalf("Push returned unexpected error: %v", err)
+	}
+	if err := q.Push(second); err != nil {
+		t.Fatalf("Push returned unexpected error: %v", err)
+	}
+	if err := q.Push(third); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Push returned unexpected error: got %v want %v", err, ErrQueueFull)
+	}
+	if q.Len() != 2 {
+		t.Errorf("Len returned unexpected length: got %v want %v", q.Len(), 2)
+	}
+
+	q.Close()
+	if err := q.Push(third); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Push returned unexpected error: got %v want %v", err, ErrQueueClosed)
+	}
+
+	// A closed queue is drained before it reports being closed.
+	for _, expected := range []string{"first", "second"} {
+		j, err := q.Pop(context.Background())
+		if err != nil {
+			t.Fatalf("Pop returned unexpected error: %v", err)
+		}
+		if j.ID() != expected {
+			t.Errorf("Pop returned jobs out of order: got %v want %v", j.ID(), expected)
+		}
+	}
+	if _, err := q.Pop(context.Background()); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Pop returned unexpected error: got %v want %v", err, ErrQueueClosed)
+	}
+}
+
+func TestMemQueueHandOff(t *testing.T) {
+	q := NewMemQueue(0)
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	task := TaskBuilder("uuid", taskFn).Build()
+
+	if err := q.Push(task); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Push returned unexpected error: got %v want %v", err, ErrQueueFull)
+	}
+
+	popped := make(chan Job)
+	go func() {
+		j, _ := q.Pop(context.Background())
+		popped <- j
+	}()
+
+	// Wait for the consumer to block on the queue.
+	deadline := time.Now().Add(time.Second)
+	for q.Push(task) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Push did not hand the job off to the waiting consumer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if j := <-popped; j != task {
+		t.Errorf("Pop returned unexpected job: got %v want %v", j.ID(), task.ID())
+	}
+}
+
+func TestMemQueuePopContextDone(t *testing.T) {
+	q := NewMemQueue(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := q.Pop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Pop returned unexpected error: got %v want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMemQueuePriority(t *testing.T) {
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	build := func(id string, priority int) Job {
+		return TaskBuilder(id, taskFn).Priority(priority).Build()
+	}
+
+	tests := []struct {
+		name     string
+		aging    time.Duration
+		wait     time.Duration
+		expected []string
+	}{
+		{"strict", 0, 0, []string{"high", "urgent", "mid", "low", "batch"}},
+		{"aged", 50 * time.Millisecond, 150 * time.Millisecond, []string{"low", "batch", "high", "urgent", "mid"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewMemQueueWithAging(5, tt.aging)
+			// the low priority jobs wait before the flood of higher priority ones
+			q.Push(build("low", 0))
+			q.Push(build("batch", 0))
+			time.Sleep(tt.wait)
+			q.Push(build("high", 2))
+			q.Push(build("mid", 1))
+			q.Push(build("urgent", 2))
+
+			depth := q.Depth()
+			for priority, expected := range map[int]int{0: 2, 1: 1, 2: 2} {
+				if depth[priority] != expected {
+					t.Errorf("unexpected depth of priority %d: got %v want %v", priority, depth[priority], expected)
+				}
+			}
+
+			for _, expected := range tt.expected {
+				j, err := q.Pop(context.Background())
+				if err != nil {
+					t.Fatalf("Pop returned unexpected error: %v", err)
+				}
+				if j.ID() != expected {
+					t.Errorf("Pop returned jobs out of order: got %v want %v", j.ID(), expected)
+				}
+			}
+			if len(q.Depth()) != 0 {
+				t.Errorf("unexpected depth of an empty queue: got %v", q.Depth())
+			}
+		})
+	}
+}
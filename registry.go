@@ -0,0 +1,283 @@
+package iocast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTaskNotRegistered     = errors.New("task is not registered")
+	ErrTaskAlreadyRegistered = errors.New("task is already registered")
+	ErrTaskNotSerializable   = errors.New("task is not serializable")
+	ErrInvalidTaskArgs       = errors.New("invalid task arguments")
+)
+
+// TaskEnvelope is the serializable form of a task. It carries the name the task's
+// handler is registered with instead of the handler itself, so it can be persisted
+// or sent over the wire and turned back into a task by a registry.
+type TaskEnvelope struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Args       []byte          `json:"args"`
+	MaxRetries int             `json:"max_retries,omitempty"`
+	BackOff    []time.Duration `json:"backoff,omitempty"`
+	Priority   int             `json:"priority,omitempty"`
+	Queue      string          `json:"queue,omitempty"`
+	Timeout    time.Duration   `json:"timeout,omitempty"`
+	Deadline   time.Time       `json:"deadline,omitempty"`
+	Tags       []string        `json:"tags,omitempty"`
+}
+
+// HandlerOptions configures the tasks a registered handler is rebuilt into, with what
+// cannot be carried by their envelopes.
+type HandlerOptions[T any] struct {
+	// ArgCodec and OutCodec encode the arguments and the results of the handler, they
+	// default to the registry's codec.
+	ArgCodec Codec
+	OutCodec Codec
+	// Database stores the results of the tasks.
+	Database DB
+	// Timeout is the maximum duration of every attempt of the tasks whose envelopes set none.
+	Timeout time.Duration
+	// Tags are stored with the metadata of every task, before the tags of its envelope.
+	Tags []string
+	// RetryIf and PermanentPanics decide which errors the tasks retry, see the task builder's.
+	RetryIf         func(error) bool
+	PermanentPanics bool
+	// OnStart, OnRetry, OnSuccess, OnFailure and OnComplete are the hooks of the tasks.
+	OnStart    func(Metadata)
+	OnRetry    func(attempt int, err error)
+	OnSuccess  func(Result[T])
+	OnFailure  func(Result[T])
+	OnComplete func(Result[T])
+	// Middleware wraps every attempt of the tasks.
+	Middleware []Middleware
+}
+
+// apply passes the options to the builder of a rebuilt task.
+func (o HandlerOptions[T]) apply(b *taskBuilder[T]) {
+	if o.Database != nil {
+		b.Database(o.Database)
+	}
+	if o.Timeout > 0 {
+		b.Timeout(o.Timeout)
+	}
+	if len(o.Tags) > 0 {
+		b.Tags(o.Tags...)
+	}
+	if o.RetryIf != nil {
+		b.RetryIf(o.RetryIf)
+	}
+	if o.PermanentPanics {
+		b.PermanentPanics()
+	}
+	if o.OnStart != nil {
+		b.OnStart(o.OnStart)
+	}
+	if o.OnRetry != nil {
+		b.OnRetry(o.OnRetry)
+	}
+	if o.OnSuccess != nil {
+		b.OnSuccess(o.OnSuccess)
+	}
+	if o.OnFailure != nil {
+		b.OnFailure(o.OnFailure)
+	}
+	if o.OnComplete != nil {
+		b.OnComplete(o.OnComplete)
+	}
+	b.Use(o.Middleware...)
+}
+
+type handler struct {
+	encodeArgs func(args any) ([]byte, error)
+	build      func(ctx context.Context, env TaskEnvelope) (Job, error)
+	encodeOut  func(out any) ([]byte, error)
+	decodeOut  func(data []byte) (any, error)
+}
+
+// Registry maps task names to typed handlers so tasks can be serialized and rehydrated.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]*handler
+	codec    Codec
+}
+
+// NewRegistry creates and returns a new registry that encodes arguments and results with the given codec.
+func NewRegistry(codec Codec) *Registry {
+	return &Registry{
+		handlers: make(map[string]*handler),
+		codec:    codec,
+	}
+}
+
+// Register registers a handler under the given name, using the registry's codec for its arguments and results.
+func Register[Arg, T any](r *Registry, name string, fn func(ctx context.Context, args Arg) (T, error)) error {
+	return RegisterWithCodecs(r, name, fn, r.codec, r.codec)
+}
+
+// RegisterWithCodecs registers a handler under the given name with dedicated codecs for its arguments and results.
+func RegisterWithCodecs[Arg, T any](
+	r *Registry,
+	name string,
+	fn func(ctx context.Context, args Arg) (T, error),
+	argCodec, outCodec Codec) error {
+	return RegisterWithOptions(r, name, fn, HandlerOptions[T]{ArgCodec: argCodec, OutCodec: outCodec})
+}
+
+// RegisterWithOptions registers a handler under the given name, the tasks it is rebuilt
+// into are configured with the given options along with their envelopes.
+func RegisterWithOptions[Arg, T any](
+	r *Registry,
+	name string,
+	fn func(ctx context.Context, args Arg) (T, error),
+	opts HandlerOptions[T]) error {
+	argCodec, outCodec := opts.ArgCodec, opts.OutCodec
+	if argCodec == nil {
+		argCodec = r.codec
+	}
+	if outCodec == nil {
+		outCodec = r.codec
+	}
+	h := &handler{
+		encodeArgs: func(args any) ([]byte, error) {
+			typed, ok := args.(Arg)
+			if !ok {
+				return nil, fmt.Errorf("%w: task %s expects %T, got %T", ErrInvalidTaskArgs, name, typed, args)
+			}
+			return argCodec.Marshal(typed)
+		},
+		build: func(ctx context.Context, env TaskEnvelope) (Job, error) {
+			var args Arg
+			if err := argCodec.Unmarshal(env.Args, &args); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidTaskArgs, err)
+			}
+			b := TaskBuilder(env.ID, NewTaskFunc(ctx, args, fn))
+			opts.apply(b)
+			if env.MaxRetries > 0 {
+				b.MaxRetries(env.MaxRetries)
+			}
+			if len(env.BackOff) > 0 {
+				b.BackOff(env.BackOff)
+			}
+			if env.Timeout > 0 {
+				b.Timeout(env.Timeout)
+			}
+			if !env.Deadline.IsZero() {
+				b.Deadline(env.Deadline)
+			}
+			b.Priority(env.Priority).Queue(env.Queue).Tags(env.Tags...)
+			b.envelope = &env
+			return b.Build(), nil
+		},
+		encodeOut: func(out any) ([]byte, error) {
+			typed, ok := out.(T)
+			if !ok {
+				return nil, fmt.Errorf("task %s returns %T, got %T", name, typed, out)
+			}
+			return outCodec.Marshal(typed)
+		},
+		decodeOut: func(data []byte) (any, error) {
+			var out T
+			err := outCodec.Unmarshal(data, &out)
+			return out, err
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.handlers[name]; ok {
+		return fmt.Errorf("%w: %s", ErrTaskAlreadyRegistered, name)
+	}
+	r.handlers[name] = h
+	return nil
+}
+
+func (r *Registry) handler(name string) (*handler, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.handlers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotRegistered, name)
+	}
+	return h, nil
+}
+
+// Envelope encodes the arguments and returns the envelope of a task run by the named handler.
+func (r *Registry) Envelope(id, name string, args any) (TaskEnvelope, error) {
+	h, err := r.handler(name)
+	if err != nil {
+		return TaskEnvelope{}, err
+	}
+	data, err := h.encodeArgs(args)
+	if err != nil {
+		return TaskEnvelope{}, err
+	}
+	return TaskEnvelope{ID: id, Name: name, Args: data}, nil
+}
+
+// NewJob rehydrates the task described by the envelope.
+func (r *Registry) NewJob(ctx context.Context, env TaskEnvelope) (Job, error) {
+	h, err := r.handler(env.Name)
+	if err != nil {
+		return nil, err
+	}
+	return h.build(ctx, env)
+}
+
+// NewRegisteredTask rehydrates the task described by the envelope as a typed task.
+func NewRegisteredTask[T any](ctx context.Context, r *Registry, env TaskEnvelope) (*Task[T], error) {
+	j, err := r.NewJob(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := j.(*Task[T])
+	if !ok {
+		return nil, fmt.Errorf("task %s does not return %T", env.Name, *new(T))
+	}
+	return t, nil
+}
+
+// EncodeResult encodes the output of a task run by the named handler.
+func (r *Registry) EncodeResult(name string, out any) ([]byte, error) {
+	h, err := r.handler(name)
+	if err != nil {
+		return nil, err
+	}
+	return h.encodeOut(out)
+}
+
+// DecodeResult decodes the output of a task run by the named handler into its registered type.
+func (r *Registry) DecodeResult(name string, data []byte) (any, error) {
+	h, err := r.handler(name)
+	if err != nil {
+		return nil, err
+	}
+	return h.decodeOut(data)
+}
+
+// EncodeJob encodes the envelope of a job that was created by a registry.
+func (r *Registry) EncodeJob(j Job) ([]byte, error) {
+	s, ok := j.(interface{ Envelope() (TaskEnvelope, error) })
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotSerializable, j.ID())
+	}
+	env, err := s.Envelope()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// DecodeJob decodes an envelope encoded by EncodeJob and rehydrates its task.
+func (r *Registry) DecodeJob(data []byte) (Job, error) {
+	var env TaskEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	return r.NewJob(context.Background(), env)
+}
@@ -0,0 +1,185 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testRegistryArgs struct {
+	Text  string `json:"text"`
+	Times int    `json:"times"`
+}
+
+func testRepeatFn(_ context.Context, args testRegistryArgs) (string, error) {
+	return strings.Repeat(args.Text, args.Times), nil
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(JSONCodec)
+	if err := Register(r, "repeat", testRepeatFn); err != nil {
+		t.Fatalf("Register returned unexpected error: %v", err)
+	}
+
+	err := Register(r, "repeat", testRepeatFn)
+	if !errors.Is(err, ErrTaskAlreadyRegistered) {
+		t.Errorf("Register returned unexpected error: got %v want %v", err, ErrTaskAlreadyRegistered)
+	}
+
+	env, err := r.Envelope("id", "repeat", testRegistryArgs{Text: "ab", Times: 3})
+	if err != nil {
+		t.Fatalf("Envelope returned unexpected error: %v", err)
+	}
+	env.MaxRetries = 2
+	env.BackOff = []time.Duration{time.Millisecond, 2 * time.Millisecond}
+	env.Priority = 3
+
+	data, err := r.EncodeJob(mustNewJob(t, r, env))
+	if err != nil {
+		t.Fatalf("EncodeJob returned unexpected error: %v", err)
+	}
+	j, err := r.DecodeJob(data)
+	if err != nil {
+		t.Fatalf("DecodeJob returned unexpected error: %v", err)
+	}
+
+	task, ok := j.(*Task[string])
+	if !ok {
+		t.Fatalf("DecodeJob returned unexpected job type: %T", j)
+	}
+	if task.ID() != "id" {
+		t.Errorf("rehydrated task has wrong id: got %v want %v", task.ID(), "id")
+	}
+	if task.maxRetries != 2 {
+		t.Errorf("rehydrated task has wrong max retries: got %v want %v", task.maxRetries, 2)
+	}
+	if task.priority() != 3 {
+		t.Errorf("rehydrated task has wrong priority: got %v want %v", task.priority(), 3)
+	}
+
+	task.Exec(context.Background())
+	result := <-task.Wait()
+	if result.Out != "ababab" {
+		t.Errorf("rehydrated task returned unexpected output: got %v want %v", result.Out, "ababab")
+	}
+
+	out, err := r.EncodeResult("repeat", result.Out)
+	if err != nil {
+		t.Fatalf("EncodeResult returned unexpected error: %v", err)
+	}
+	decoded, err := r.DecodeResult("repeat", out)
+	if err != nil {
+		t.Fatalf("DecodeResult returned unexpected error: %v", err)
+	}
+	if decoded != "ababab" {
+		t.Errorf("DecodeResult returned unexpected output: got %v want %v", decoded, "ababab")
+	}
+}
+
+func TestRegistryWithOptions(t *testing.T) {
+	var attempts int
+	failing := func(_ context.Context, args testRegistryArgs) (string, error) {
+		attempts++
+		return "", errors.New(args.Text)
+	}
+	var completed Result[string]
+	db := NewMemDB(&sync.Map{})
+	r := NewRegistry(JSONCodec)
+	err := RegisterWithOptions(r, "failing", failing, HandlerOptions[string]{
+		Database:   db,
+		Timeout:    time.Second,
+		Tags:       []string{"handler"},
+		RetryIf:    func(err error) bool { return err.Error() != "permanent" },
+		OnComplete: func(result Result[string]) { completed = result },
+	})
+	if err != nil {
+		t.Fatalf("RegisterWithOptions returned unexpected error: %v", err)
+	}
+
+	env, err := r.Envelope("id", "failing", testRegistryArgs{Text: "permanent"})
+	if err != nil {
+		t.Fatalf("Envelope returned unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(time.Minute).Truncate(time.Second)
+	env.MaxRetries = 3
+	env.Timeout = 2 * time.Second
+	env.Deadline = deadline
+	env.Tags = []string{"envelope"}
+
+	data, err := r.EncodeJob(mustNewJob(t, r, env))
+	if err != nil {
+		t.Fatalf("EncodeJob returned unexpected error: %v", err)
+	}
+	j, err := r.DecodeJob(data)
+	if err != nil {
+		t.Fatalf("DecodeJob returned unexpected error: %v", err)
+	}
+	task, ok := j.(*Task[string])
+	if !ok {
+		t.Fatalf("DecodeJob returned unexpected job type: %T", j)
+	}
+	if task.timeout != 2*time.Second {
+		t.Errorf("rehydrated task has wrong timeout: got %v want %v", task.timeout, 2*time.Second)
+	}
+	if !task.deadline.Equal(deadline) {
+		t.Errorf("rehydrated task has wrong deadline: got %v want %v", task.deadline, deadline)
+	}
+	if tags := task.Metadata().Tags; len(tags) != 2 || tags[0] != "handler" || tags[1] != "envelope" {
+		t.Errorf("rehydrated task has wrong tags: got %v want %v", tags, []string{"handler", "envelope"})
+	}
+
+	task.Exec(context.Background())
+	if err := task.Write(); err != nil {
+		t.Fatalf("Write returned unexpected error: %v", err)
+	}
+	// the handler's RetryIf stops the retries
+	if attempts != 1 {
+		t.Errorf("unexpected number of attempts: got %v want %v", attempts, 1)
+	}
+	if completed.Err == nil {
+		t.Error("the handler's completion hook did not run")
+	}
+	if _, err := ReadResult[string](db, "id"); err != nil {
+		t.Errorf("the result was not written to the handler's database: %v", err)
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	r := NewRegistry(JSONCodec)
+	if err := Register(r, "repeat", testRepeatFn); err != nil {
+		t.Fatalf("Register returned unexpected error: %v", err)
+	}
+
+	_, err := r.Envelope("id", "unknown", testRegistryArgs{})
+	if !errors.Is(err, ErrTaskNotRegistered) {
+		t.Errorf("Envelope returned unexpected error: got %v want %v", err, ErrTaskNotRegistered)
+	}
+
+	_, err = r.Envelope("id", "repeat", "wrong type")
+	if !errors.Is(err, ErrInvalidTaskArgs) {
+		t.Errorf("Envelope returned unexpected error: got %v want %v", err, ErrInvalidTaskArgs)
+	}
+
+	_, err = NewRegisteredTask[int](context.Background(), r, TaskEnvelope{ID: "id", Name: "repeat", Args: []byte("{}")})
+	if err == nil {
+		t.Errorf("NewRegisteredTask did not return expected error for the wrong result type")
+	}
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	_, err = r.EncodeJob(TaskBuilder("closure", taskFn).Build())
+	if !errors.Is(err, ErrTaskNotSerializable) {
+		t.Errorf("EncodeJob returned unexpected error: got %v want %v", err, ErrTaskNotSerializable)
+	}
+}
+
+func mustNewJob(t *testing.T, r *Registry, env TaskEnvelope) Job {
+	t.Helper()
+	j, err := r.NewJob(context.Background(), env)
+	if err != nil {
+		t.Fatalf("NewJob returned unexpected error: %v", err)
+	}
+	return j
+}
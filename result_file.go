@@ -0,0 +1,523 @@
+package iocast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	resultOpWrite  = "write"
+	resultOpDelete = "delete"
+
+	resultSegmentExt = ".jsonl"
+
+	defaultSegmentSize = 16 * 1024 * 1024
+)
+
+var (
+	ErrResultStoreClosed = errors.New("result store is closed")
+)
+
+// ResultFileOptions configures the retention and the layout of a ResultFileDB.
+type ResultFileOptions struct {
+	// SegmentSize is the size in bytes after which a new segment file is started, 16MiB by default.
+	SegmentSize int64
+	// TTL is how long a result is kept after it is written, forever if zero.
+	TTL time.Duration
+	// MaxSize caps the size in bytes of the live results, the oldest ones are
+	// evicted to make room for new ones. There is no cap if zero.
+	MaxSize int64
+	// CompactionInterval is how often the segments are compacted in the background,
+	// never if zero. Compaction is also triggered by writes once the superseded
+	// records outgrow the live ones.
+	CompactionInterval time.Duration
+	// Codec encodes the outputs of the results, JSONCodec by default.
+	Codec Codec
+}
+
+type resultRecord struct {
+	Op     string         `json:"op"`
+	ID     string         `json:"id"`
+	At     time.Time      `json:"at"`
+	Result *encodedResult `json:"result,omitempty"`
+}
+
+// resultLocation is where the latest record of a result lives.
+type resultLocation struct {
+	segment int
+	offset  int64
+	size    int64
+	at      time.Time
+	seq     uint64
+}
+
+// resultEntry is a result in write order.
+type resultEntry struct {
+	id  string
+	seq uint64
+}
+
+// ResultFileDB is a durable result database backed by segmented JSON lines files
+// in a directory. Every record is appended to the active segment and synced to
+// disk, and an in-memory index points to the latest record of every result.
+type ResultFileDB struct {
+	mu       sync.Mutex
+	dir      string
+	opts     ResultFileOptions
+	segments map[int]*os.File
+	sizes    map[int]int64
+	active   int
+	index    map[string]resultLocation
+	order    []resultEntry
+	seq      uint64
+	live     int64
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewResultFileDB opens the result database in dir, creating it if needed, and restores the results it holds.
+func NewResultFileDB(dir string, opts ResultFileOptions) (*ResultFileDB, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	m := &ResultFileDB{
+		dir:      dir,
+		opts:     opts,
+		segments: make(map[int]*os.File),
+		sizes:    make(map[int]int64),
+		index:    make(map[string]resultLocation),
+		done:     make(chan struct{}),
+	}
+	if err := m.load(); err != nil {
+		m.closeSegments()
+		return nil, err
+	}
+	m.mu.Lock()
+	err := m.compact()
+	m.mu.Unlock()
+	if err != nil {
+		m.closeSegments()
+		return nil, err
+	}
+
+	if opts.CompactionInterval > 0 {
+		m.wg.Add(1)
+		go m.compactPeriodically()
+	}
+	return m, nil
+}
+
+func (m *ResultFileDB) load() error {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return err
+	}
+	var segments []int
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), resultSegmentExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		n, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, n)
+	}
+	sort.Ints(segments)
+
+	for i, n := range segments {
+		if err := m.loadSegment(n, i == len(segments)-1); err != nil {
+			return err
+		}
+		m.active = n
+	}
+	m.evict(time.Now())
+	return nil
+}
+
+// loadSegment replays the records of a segment into the index. A torn write at
+// the tail of the last segment is truncated so that new records are not appended to it.
+func (m *ResultFileDB) loadSegment(n int, last bool) error {
+	f, err := os.OpenFile(m.segmentPath(n), os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	m.segments[n] = f
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 && last {
+				log.Printf("truncating torn result record in %s", m.segmentPath(n))
+				if err := f.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		size := int64(len(line))
+
+		var rec resultRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			log.Printf("skipping corrupted result record in %s: %v", m.segmentPath(n), err)
+			offset += size
+			continue
+		}
+		switch rec.Op {
+		case resultOpWrite:
+			m.put(rec.ID, resultLocation{segment: n, offset: offset, size: size, at: rec.At})
+		case resultOpDelete:
+			m.remove(rec.ID)
+		}
+		offset += size
+	}
+	m.sizes[n] = offset
+	return nil
+}
+
+// Write stores the result to the database.
+func (m *ResultFileDB) Write(id string, r Result[any]) error {
+	e, err := encodeResult(m.opts.Codec, r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.segments == nil {
+		return ErrResultStoreClosed
+	}
+	now := time.Now()
+	loc, err := m.append(resultRecord{Op: resultOpWrite, ID: id, At: now, Result: &e})
+	if err != nil {
+		return err
+	}
+	m.put(id, loc)
+	m.evict(now)
+	return m.maybeCompact()
+}
+
+// Read returns the result with the given id.
+func (m *ResultFileDB) Read(id string) (Result[any], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.segments == nil {
+		return Result[any]{}, ErrResultStoreClosed
+	}
+	loc, ok := m.index[id]
+	if !ok || m.expired(loc, time.Now()) {
+		return Result[any]{}, fmt.Errorf("%w: %s", ErrResultNotFound, id)
+	}
+	return m.read(loc)
+}
+
+// List returns the results matching the filter in the order they were created.
+func (m *ResultFileDB) List(f Filter) ([]Record[any], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.segments == nil {
+		return nil, ErrResultStoreClosed
+	}
+	now := time.Now()
+	var records []Record[any]
+	for id, loc := range m.index {
+		if m.expired(loc, now) {
+			continue
+		}
+		r, err := m.read(loc)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the result of %s: %w", id, err)
+		}
+		if f.Match(r.Metadata) {
+			records = append(records, Record[any]{ID: id, Result: r})
+		}
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// Delete removes the result with the given id.
+func (m *ResultFileDB) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.segments == nil {
+		return ErrResultStoreClosed
+	}
+	if _, ok := m.index[id]; !ok {
+		return nil
+	}
+	if _, err := m.append(resultRecord{Op: resultOpDelete, ID: id, At: time.Now()}); err != nil {
+		return err
+	}
+	m.remove(id)
+	return m.maybeCompact()
+}
+
+// Compact drops the expired, evicted and superseded records by rewriting the live results into new segments.
+func (m *ResultFileDB) Compact() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.segments == nil {
+		return ErrResultStoreClosed
+	}
+	return m.compact()
+}
+
+// Close stops the background compaction and closes the segment files.
+func (m *ResultFileDB) Close() error {
+	m.mu.Lock()
+	if m.segments == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	select {
+	case <-m.done:
+	default:
+		close(m.done)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closeSegments()
+}
+
+func (m *ResultFileDB) closeSegments() error {
+	var err error
+	for _, f := range m.segments {
+		err = errors.Join(err, f.Close())
+	}
+	m.segments = nil
+	return err
+}
+
+func (m *ResultFileDB) compactPeriodically() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.opts.CompactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Compact(); err != nil {
+				log.Printf("error compacting the results in %s: %v", m.dir, err)
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *ResultFileDB) segmentPath(n int) string {
+	return filepath.Join(m.dir, fmt.Sprintf("%08d%s", n, resultSegmentExt))
+}
+
+// put points the index to the latest record of the result.
+func (m *ResultFileDB) put(id string, loc resultLocation) {
+	m.remove(id)
+	m.seq++
+	loc.seq = m.seq
+	m.index[id] = loc
+	m.order = append(m.order, resultEntry{id: id, seq: loc.seq})
+	m.live += loc.size
+}
+
+func (m *ResultFileDB) remove(id string) {
+	if loc, ok := m.index[id]; ok {
+		m.live -= loc.size
+		delete(m.index, id)
+	}
+}
+
+func (m *ResultFileDB) expired(loc resultLocation, now time.Time) bool {
+	return m.opts.TTL > 0 && now.Sub(loc.at) > m.opts.TTL
+}
+
+// evict drops the oldest results while they are expired or the live results exceed the size cap.
+func (m *ResultFileDB) evict(now time.Time) {
+	for len(m.order) > 0 {
+		e := m.order[0]
+		loc, ok := m.index[e.id]
+		if ok && loc.seq == e.seq {
+			if !m.expired(loc, now) && (m.opts.MaxSize <= 0 || m.live <= m.opts.MaxSize) {
+				return
+			}
+			m.remove(e.id)
+		}
+		m.order[0] = resultEntry{}
+		m.order = m.order[1:]
+	}
+}
+
+func (m *ResultFileDB) read(loc resultLocation) (Result[any], error) {
+	line := make([]byte, loc.size)
+	if _, err := m.segments[loc.segment].ReadAt(line, loc.offset); err != nil {
+		return Result[any]{}, err
+	}
+	var rec resultRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return Result[any]{}, err
+	}
+	if rec.Result == nil {
+		return Result[any]{}, fmt.Errorf("record of %s has no result", rec.ID)
+	}
+	return rec.Result.result(), nil
+}
+
+// append writes the record to the active segment, starting a new one when it is full.
+func (m *ResultFileDB) append(rec resultRecord) (resultLocation, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return resultLocation{}, err
+	}
+	data = append(data, '\n')
+
+	f, ok := m.segments[m.active]
+	if !ok || m.sizes[m.active] >= m.opts.SegmentSize {
+		if f, err = m.rotate(); err != nil {
+			return resultLocation{}, err
+		}
+	}
+	offset := m.sizes[m.active]
+	if _, err := f.Write(data); err != nil {
+		return resultLocation{}, err
+	}
+	if err := f.Sync(); err != nil {
+		return resultLocation{}, err
+	}
+	m.sizes[m.active] += int64(len(data))
+	return resultLocation{
+		segment: m.active,
+		offset:  offset,
+		size:    int64(len(data)),
+		at:      rec.At,
+	}, nil
+}
+
+// rotate starts a new active segment.
+func (m *ResultFileDB) rotate() (*os.File, error) {
+	n := m.active + 1
+	f, err := os.OpenFile(m.segmentPath(n), os.O_CREATE|os.O_EXCL|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	m.segments[n] = f
+	m.sizes[n] = 0
+	m.active = n
+	return f, nil
+}
+
+func (m *ResultFileDB) maybeCompact() error {
+	if size := m.size(); size >= m.opts.SegmentSize && size > 2*m.live {
+		return m.compact()
+	}
+	return nil
+}
+
+// size returns the size of the segments on disk.
+func (m *ResultFileDB) size() int64 {
+	var size int64
+	for _, s := range m.sizes {
+		size += s
+	}
+	return size
+}
+
+// compact copies the live records in write order into new segments and then removes
+// the old ones. If the process stops halfway, the old segments are replayed first and
+// the copies supersede them.
+func (m *ResultFileDB) compact() error {
+	m.evict(time.Now())
+	if m.size() == m.live {
+		// there is nothing to drop
+		return nil
+	}
+
+	old := make([]int, 0, len(m.segments))
+	for n := range m.segments {
+		old = append(old, n)
+	}
+	sort.Ints(old)
+
+	var order []resultEntry
+	index := make(map[string]resultLocation, len(m.index))
+	for _, e := range m.order {
+		loc, ok := m.index[e.id]
+		if !ok || loc.seq != e.seq {
+			continue
+		}
+		line := make([]byte, loc.size)
+		if _, err := m.segments[loc.segment].ReadAt(line, loc.offset); err != nil {
+			return err
+		}
+		f, ok := m.segments[m.active]
+		if !ok || m.sizes[m.active] >= m.opts.SegmentSize || m.active <= lastOf(old) {
+			var err error
+			if f, err = m.rotate(); err != nil {
+				return err
+			}
+		}
+		if _, err := f.Write(line); err != nil {
+			return err
+		}
+		loc.segment = m.active
+		loc.offset = m.sizes[m.active]
+		m.sizes[m.active] += loc.size
+		index[e.id] = loc
+		order = append(order, e)
+	}
+	for n, f := range m.segments {
+		if n > lastOf(old) {
+			if err := f.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+
+	m.index = index
+	m.order = order
+	for _, n := range old {
+		m.segments[n].Close()
+		delete(m.segments, n)
+		delete(m.sizes, n)
+		if err := os.Remove(m.segmentPath(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lastOf(segments []int) int {
+	if len(segments) == 0 {
+		return -1
+	}
+	return segments[len(segments)-1]
+}
@@ -0,0 +1,242 @@
+package iocast
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testResult(out string) Result[any] {
+	return Result[any]{
+		Out:      out,
+		Metadata: Metadata{CreatetAt: time.Now().UTC(), Status: TaskStatusSuccess},
+	}
+}
+
+func TestResultFileDB(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewResultFileDB(dir, ResultFileOptions{SegmentSize: 512})
+	if err != nil {
+		t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+	}
+	for i := range 20 {
+		if err := db.Write("id"+strconv.Itoa(i%10), testResult("out"+strconv.Itoa(i))); err != nil {
+			t.Fatalf("Write returned unexpected error: %v", err)
+		}
+	}
+	failed := Result[any]{Err: ErrTaskTimedOut, Metadata: Metadata{Status: TaskStatusTimedOut}}
+	if err := db.Write("failed", failed); err != nil {
+		t.Fatalf("Write returned unexpected error: %v", err)
+	}
+	if err := db.Delete("id0"); err != nil {
+		t.Fatalf("Delete returned unexpected error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close returned unexpected error: %v", err)
+	}
+
+	// the results written as JSON are still read once the codec changes
+	db, err = NewResultFileDB(dir, ResultFileOptions{SegmentSize: 512, Codec: GobCodec})
+	if err != nil {
+		t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+	}
+	defer db.Close()
+
+	result, err := ReadResult[string](db, "id3")
+	if err != nil {
+		t.Fatalf("ReadResult returned unexpected error: %v", err)
+	}
+	if result.Out != "out13" {
+		t.Errorf("unexpected result out: got %v want %v", result.Out, "out13")
+	}
+	if _, err := db.Read("id0"); !errors.Is(err, ErrResultNotFound) {
+		t.Errorf("unexpected error reading a deleted result: got %v want %v", err, ErrResultNotFound)
+	}
+	result, err = ReadResult[string](db, "failed")
+	if err != nil {
+		t.Fatalf("ReadResult returned unexpected error: %v", err)
+	}
+	if !errors.Is(result.Err, ErrTaskTimedOut) {
+		t.Errorf("unexpected result error: got %v want %v", result.Err, ErrTaskTimedOut)
+	}
+
+	records, err := db.List(Filter{Status: TaskStatusSuccess})
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+	if len(records) != 9 {
+		t.Errorf("unexpected number of results: got %v want %v", len(records), 9)
+	}
+
+	// the superseded and deleted records were compacted away when the database was opened
+	entries, _ := os.ReadDir(dir)
+	var size int64
+	for _, e := range entries {
+		info, _ := e.Info()
+		size += info.Size()
+	}
+	if size != db.live {
+		t.Errorf("unexpected size on disk after compaction: got %v want %v", size, db.live)
+	}
+}
+
+func TestResultFileDBRetention(t *testing.T) {
+	probe, err := NewResultFileDB(t.TempDir(), ResultFileOptions{})
+	if err != nil {
+		t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+	}
+	probe.Write("id0", testResult("out"))
+	recordSize := probe.live
+	probe.Close()
+
+	tests := []struct {
+		name     string
+		opts     ResultFileOptions
+		wait     time.Duration
+		expected []string
+	}{
+		{
+			"ttl",
+			ResultFileOptions{TTL: 50 * time.Millisecond},
+			100 * time.Millisecond,
+			nil,
+		},
+		{
+			"size cap",
+			ResultFileOptions{MaxSize: 3*recordSize + recordSize/2},
+			0,
+			[]string{"id7", "id8", "id9"},
+		},
+		{
+			"no retention",
+			ResultFileOptions{},
+			0,
+			[]string{"id0", "id1", "id2", "id3", "id4", "id5", "id6", "id7", "id8", "id9"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := NewResultFileDB(dir, tt.opts)
+			if err != nil {
+				t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+			}
+			for i := range 10 {
+				if err := db.Write("id"+strconv.Itoa(i), testResult("out")); err != nil {
+					t.Fatalf("Write returned unexpected error: %v", err)
+				}
+			}
+			time.Sleep(tt.wait)
+
+			check := func() {
+				records, err := db.List(Filter{})
+				if err != nil {
+					t.Fatalf("List returned unexpected error: %v", err)
+				}
+				var ids []string
+				for _, rec := range records {
+					ids = append(ids, rec.ID)
+				}
+				if len(ids) != len(tt.expected) {
+					t.Fatalf("unexpected results: got %v want %v", ids, tt.expected)
+				}
+				for i := range ids {
+					if ids[i] != tt.expected[i] {
+						t.Fatalf("unexpected results: got %v want %v", ids, tt.expected)
+					}
+				}
+			}
+			check()
+
+			// retention is applied again after a restart
+			db.Close()
+			db, err = NewResultFileDB(dir, tt.opts)
+			if err != nil {
+				t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+			}
+			defer db.Close()
+			check()
+		})
+	}
+}
+
+func TestResultFileDBCompaction(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewResultFileDB(dir, ResultFileOptions{
+		SegmentSize:        1 << 20,
+		TTL:                50 * time.Millisecond,
+		CompactionInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Write("uuid", testResult("out")); err != nil {
+		t.Fatalf("Write returned unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		db.mu.Lock()
+		size := db.size()
+		db.mu.Unlock()
+		if size == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expired result was not compacted away: %d bytes left", size)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResultFileDBTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewResultFileDB(dir, ResultFileOptions{})
+	if err != nil {
+		t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+	}
+	if err := db.Write("uuid", testResult("out")); err != nil {
+		t.Fatalf("Write returned unexpected error: %v", err)
+	}
+	segment := db.segmentPath(db.active)
+	db.Close()
+
+	f, err := os.OpenFile(segment, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"write","id":"torn","res`)
+	f.Close()
+
+	db, err = NewResultFileDB(dir, ResultFileOptions{})
+	if err != nil {
+		t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+	}
+	if err := db.Write("next", testResult("next")); err != nil {
+		t.Fatalf("Write returned unexpected error: %v", err)
+	}
+	db.Close()
+
+	db, err = NewResultFileDB(dir, ResultFileOptions{})
+	if err != nil {
+		t.Fatalf("NewResultFileDB returned unexpected error: %v", err)
+	}
+	defer db.Close()
+	for _, id := range []string{"uuid", "next"} {
+		if _, err := db.Read(id); err != nil {
+			t.Errorf("Read %s returned unexpected error: %v", id, err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close returned unexpected error: %v", err)
+	}
+	if err := db.Write("closed", testResult("out")); !errors.Is(err, ErrResultStoreClosed) {
+		t.Errorf("unexpected error writing to a closed database: got %v want %v", err, ErrResultStoreClosed)
+	}
+}
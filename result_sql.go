@@ -0,0 +1,286 @@
+package iocast
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultResultsTable = "iocast_results"
+)
+
+var (
+	ErrInvalidTableName = errors.New("invalid table name")
+)
+
+var tableNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Dialect is the flavour of SQL spoken by a database.
+type Dialect int
+
+const (
+	// DialectSQLite targets SQLite, with ? placeholders.
+	DialectSQLite Dialect = iota
+	// DialectPostgres targets PostgreSQL, with $n placeholders.
+	DialectPostgres
+	// DialectMySQL targets MySQL and MariaDB, with ? placeholders.
+	DialectMySQL
+)
+
+// placeholder returns the placeholder of the n-th argument of a statement, starting from 1.
+func (d Dialect) placeholder(n int) string {
+	if d == DialectPostgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+func (d Dialect) createTable(table string) []string {
+	switch d {
+	case DialectMySQL:
+		return []string{
+			`CREATE TABLE IF NOT EXISTS ` + table + ` (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	status VARCHAR(32) NOT NULL,
+	created_at BIGINT,
+	started_at BIGINT,
+	finished_at BIGINT,
+	output LONGBLOB,
+	codec VARCHAR(64),
+	error LONGTEXT,
+	metadata LONGTEXT NOT NULL,
+	INDEX ` + table + `_status_created_at (status, created_at)
+)`,
+		}
+	case DialectPostgres:
+		return []string{
+			`CREATE TABLE IF NOT EXISTS ` + table + ` (
+	id TEXT NOT NULL PRIMARY KEY,
+	status TEXT NOT NULL,
+	created_at BIGINT,
+	started_at BIGINT,
+	finished_at BIGINT,
+	output BYTEA,
+	codec TEXT,
+	error TEXT,
+	metadata TEXT NOT NULL
+)`,
+			`CREATE INDEX IF NOT EXISTS ` + table + `_status_created_at ON ` + table + ` (status, created_at)`,
+		}
+	default:
+		return []string{
+			`CREATE TABLE IF NOT EXISTS ` + table + ` (
+	id TEXT NOT NULL PRIMARY KEY,
+	status TEXT NOT NULL,
+	created_at INTEGER,
+	started_at INTEGER,
+	finished_at INTEGER,
+	output BLOB,
+	codec TEXT,
+	error TEXT,
+	metadata TEXT NOT NULL
+)`,
+			`CREATE INDEX IF NOT EXISTS ` + table + `_status_created_at ON ` + table + ` (status, created_at)`,
+		}
+	}
+}
+
+var sqlColumns = []string{"id", "status", "created_at", "started_at", "finished_at", "output", "codec", "error", "metadata"}
+
+func (d Dialect) upsert(table string) string {
+	placeholders := make([]string, len(sqlColumns))
+	for i := range sqlColumns {
+		placeholders[i] = d.placeholder(i + 1)
+	}
+	updates := make([]string, 0, len(sqlColumns)-1)
+	for _, c := range sqlColumns[1:] {
+		if d == DialectMySQL {
+			updates = append(updates, c+" = VALUES("+c+")")
+		} else {
+			updates = append(updates, c+" = excluded."+c)
+		}
+	}
+
+	stmt := "INSERT INTO " + table + " (" + strings.Join(sqlColumns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+	if d == DialectMySQL {
+		return stmt + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+	return stmt + " ON CONFLICT (id) DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+// SQLDB is a result database on top of database/sql. The driver is up to the
+// user, the dialect tells how to speak to it.
+type SQLDB struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+	codec   Codec
+}
+
+// NewSQLDB creates the results table in the database if it does not exist and returns
+// a new SQLDB instance that encodes outputs as JSON. The table is named iocast_results
+// if no name is given.
+func NewSQLDB(db *sql.DB, dialect Dialect, table string) (*SQLDB, error) {
+	return NewSQLDBWithCodec(db, dialect, table, JSONCodec)
+}
+
+// NewSQLDBWithCodec creates the results table in the database if it does not exist and
+// returns a new SQLDB instance that encodes outputs with the given codec.
+func NewSQLDBWithCodec(db *sql.DB, dialect Dialect, table string, codec Codec) (*SQLDB, error) {
+	if table == "" {
+		table = defaultResultsTable
+	}
+	if !tableNameRe.MatchString(table) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTableName, table)
+	}
+	for _, stmt := range dialect.createTable(table) {
+		if _, err := db.ExecContext(context.Background(), stmt); err != nil {
+			return nil, fmt.Errorf("error creating the results table: %w", err)
+		}
+	}
+	return &SQLDB{
+		db:      db,
+		dialect: dialect,
+		table:   table,
+		codec:   codec,
+	}, nil
+}
+
+// Write stores the results to the database, replacing any previous result with the same id.
+func (s *SQLDB) Write(id string, r Result[any]) error {
+	e, err := encodeResult(s.codec, r)
+	if err != nil {
+		return err
+	}
+	var errEnvelope sql.NullString
+	if e.Err != nil {
+		data, err := json.Marshal(e.Err)
+		if err != nil {
+			return err
+		}
+		errEnvelope = sql.NullString{String: string(data), Valid: true}
+	}
+	metadata, err := json.Marshal(e.Metadata)
+	if err != nil {
+		return err
+	}
+	var status string
+	if r.Metadata.Status != nil {
+		status = fmt.Sprint(r.Metadata.Status)
+	}
+
+	_, err = s.db.ExecContext(context.Background(), s.dialect.upsert(s.table),
+		id,
+		status,
+		unixNano(r.Metadata.CreatetAt),
+		unixNano(r.Metadata.StartedAt),
+		unixNano(r.Metadata.FinishedAt),
+		e.Out,
+		e.Codec,
+		errEnvelope,
+		string(metadata),
+	)
+	return err
+}
+
+// Read returns the result with the given id.
+func (s *SQLDB) Read(id string) (Result[any], error) {
+	row := s.db.QueryRowContext(context.Background(),
+		"SELECT id, output, codec, error, metadata FROM "+s.table+" WHERE id = "+s.dialect.placeholder(1), id)
+	rec, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Result[any]{}, fmt.Errorf("%w: %s", ErrResultNotFound, id)
+	}
+	if err != nil {
+		return Result[any]{}, err
+	}
+	return rec.Result, nil
+}
+
+// List returns the results matching the filter in the order they were created.
+// The status and the time range are matched by the database, the tag by the store.
+func (s *SQLDB) List(f Filter) ([]Record[any], error) {
+	var where []string
+	var args []any
+	if f.Status != nil {
+		args = append(args, fmt.Sprint(f.Status))
+		where = append(where, "status = "+s.dialect.placeholder(len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From.UnixNano())
+		where = append(where, "created_at >= "+s.dialect.placeholder(len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To.UnixNano())
+		where = append(where, "created_at < "+s.dialect.placeholder(len(args)))
+	}
+	query := "SELECT id, output, codec, error, metadata FROM " + s.table
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := s.db.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record[any]
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		if f.Match(rec.Result.Metadata) {
+			records = append(records, rec)
+		}
+	}
+	return records, rows.Err()
+}
+
+// Delete removes the result with the given id.
+func (s *SQLDB) Delete(id string) error {
+	_, err := s.db.ExecContext(context.Background(),
+		"DELETE FROM "+s.table+" WHERE id = "+s.dialect.placeholder(1), id)
+	return err
+}
+
+func scanRecord(row interface{ Scan(...any) error }) (Record[any], error) {
+	var (
+		id          string
+		e           encodedResult
+		codec       sql.NullString
+		errEnvelope sql.NullString
+		metadata    string
+	)
+	if err := row.Scan(&id, &e.Out, &codec, &errEnvelope, &metadata); err != nil {
+		return Record[any]{}, err
+	}
+	e.Codec = codec.String
+
+	if errEnvelope.Valid {
+		if err := json.Unmarshal([]byte(errEnvelope.String), &e.Err); err != nil {
+			return Record[any]{}, fmt.Errorf("error decoding the error of %s: %w", id, err)
+		}
+	}
+	if err := json.Unmarshal([]byte(metadata), &e.Metadata); err != nil {
+		return Record[any]{}, fmt.Errorf("error decoding the metadata of %s: %w", id, err)
+	}
+	return Record[any]{ID: id, Result: e.result()}, nil
+}
+
+// unixNano returns the time as nanoseconds since the epoch, or NULL for the zero time.
+func unixNano(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
@@ -0,0 +1,334 @@
+package iocast
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSQLDriver records the statements executed through it and keeps the rows of a
+// single results table. It understands just the statements SQLDB issues.
+type testSQLDriver struct {
+	mu    sync.Mutex
+	execs []string
+	rows  map[string][]driver.Value
+}
+
+func (d *testSQLDriver) Open(string) (driver.Conn, error) {
+	return testSQLConn{d}, nil
+}
+
+// Connect lets the driver be opened with sql.OpenDB, without registering it.
+func (d *testSQLDriver) Connect(context.Context) (driver.Conn, error) {
+	return testSQLConn{d}, nil
+}
+
+func (d *testSQLDriver) Driver() driver.Driver {
+	return d
+}
+
+type testSQLConn struct {
+	d *testSQLDriver
+}
+
+func (testSQLConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (testSQLConn) Close() error {
+	return nil
+}
+
+func (testSQLConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c testSQLConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.execs = append(c.d.execs, query)
+
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO"):
+		if c.d.rows == nil {
+			c.d.rows = make(map[string][]driver.Value)
+		}
+		row := make([]driver.Value, len(args))
+		for i, arg := range args {
+			row[i] = arg.Value
+		}
+		id, _ := row[0].(string)
+		c.d.rows[id] = row
+	case strings.HasPrefix(query, "DELETE FROM"):
+		id, _ := args[0].Value.(string)
+		delete(c.d.rows, id)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// QueryContext selects the rows matching the conditions of the WHERE clause, which are
+// comparisons of a column with a placeholder joined by AND, ordered by creation time and id.
+func (c testSQLConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+
+	selected, rest, _ := strings.Cut(strings.TrimPrefix(query, "SELECT "), " FROM ")
+	columns := strings.Split(selected, ", ")
+	rest, _, _ = strings.Cut(rest, " ORDER BY ")
+	var conditions []string
+	if _, where, ok := strings.Cut(rest, " WHERE "); ok {
+		conditions = strings.Split(where, " AND ")
+	}
+
+	var matched [][]driver.Value
+	for _, row := range c.d.rows {
+		ok := true
+		for i, condition := range conditions {
+			fields := strings.Fields(condition)
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("unsupported condition %q", condition)
+			}
+			ok = ok && testSQLCompare(row[slices.Index(sqlColumns, fields[0])], fields[1], args[i].Value)
+		}
+		if ok {
+			matched = append(matched, row)
+		}
+	}
+	slices.SortFunc(matched, func(a, b []driver.Value) int {
+		if created := testSQLInt(a[2]) - testSQLInt(b[2]); created != 0 {
+			return int(created)
+		}
+		return strings.Compare(fmt.Sprint(a[0]), fmt.Sprint(b[0]))
+	})
+
+	rows := &testSQLRows{columns: columns}
+	for _, row := range matched {
+		values := make([]driver.Value, len(columns))
+		for i, column := range columns {
+			values[i] = row[slices.Index(sqlColumns, column)]
+		}
+		rows.values = append(rows.values, values)
+	}
+	return rows, nil
+}
+
+// testSQLCompare compares a column with an argument the way SQL does, NULL matches nothing.
+func testSQLCompare(column any, op string, arg any) bool {
+	if column == nil {
+		return false
+	}
+	switch op {
+	case "=":
+		return column == arg
+	case ">=":
+		return testSQLInt(column) >= testSQLInt(arg)
+	case "<":
+		return testSQLInt(column) < testSQLInt(arg)
+	}
+	return false
+}
+
+func testSQLInt(v any) int64 {
+	n, _ := v.(int64)
+	return n
+}
+
+type testSQLRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *testSQLRows) Columns() []string {
+	return r.columns
+}
+
+func (r *testSQLRows) Close() error {
+	return nil
+}
+
+func (r *testSQLRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestSQLDialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		upsert  string
+	}{
+		{
+			"sqlite",
+			DialectSQLite,
+			"INSERT INTO results (id, status, created_at, started_at, finished_at, output, codec, error, metadata) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) " +
+				"ON CONFLICT (id) DO UPDATE SET status = excluded.status, created_at = excluded.created_at, started_at = excluded.started_at, " +
+				"finished_at = excluded.finished_at, output = excluded.output, codec = excluded.codec, error = excluded.error, metadata = excluded.metadata",
+		},
+		{
+			"postgres",
+			DialectPostgres,
+			"INSERT INTO results (id, status, created_at, started_at, finished_at, output, codec, error, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) " +
+				"ON CONFLICT (id) DO UPDATE SET status = excluded.status, created_at = excluded.created_at, started_at = excluded.started_at, " +
+				"finished_at = excluded.finished_at, output = excluded.output, codec = excluded.codec, error = excluded.error, metadata = excluded.metadata",
+		},
+		{
+			"mysql",
+			DialectMySQL,
+			"INSERT INTO results (id, status, created_at, started_at, finished_at, output, codec, error, metadata) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) " +
+				"ON DUPLICATE KEY UPDATE status = VALUES(status), created_at = VALUES(created_at), started_at = VALUES(started_at), " +
+				"finished_at = VALUES(finished_at), output = VALUES(output), codec = VALUES(codec), error = VALUES(error), metadata = VALUES(metadata)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &testSQLDriver{}
+			conn := sql.OpenDB(d)
+			defer conn.Close()
+
+			db, err := NewSQLDB(conn, tt.dialect, "results")
+			if err != nil {
+				t.Fatalf("NewSQLDB returned unexpected error: %v", err)
+			}
+			if len(d.execs) == 0 || !strings.HasPrefix(d.execs[0], "CREATE TABLE IF NOT EXISTS results") {
+				t.Errorf("unexpected statements creating the table: %v", d.execs)
+			}
+
+			if err := db.Write("uuid", testResult("out")); err != nil {
+				t.Fatalf("Write returned unexpected error: %v", err)
+			}
+			if upsert := d.execs[len(d.execs)-1]; upsert != tt.upsert {
+				t.Errorf("unexpected upsert:\ngot  %v\nwant %v", upsert, tt.upsert)
+			}
+		})
+	}
+}
+
+func TestSQLDBInvalidTable(t *testing.T) {
+	for _, table := range []string{"results; DROP TABLE users", "1results", "my-results"} {
+		if _, err := NewSQLDB(nil, DialectSQLite, table); !errors.Is(err, ErrInvalidTableName) {
+			t.Errorf("unexpected error for table %q: got %v want %v", table, err, ErrInvalidTableName)
+		}
+	}
+}
+
+func TestSQLDB(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []struct {
+		id     string
+		result Result[any]
+	}{
+		{"first", Result[any]{
+			Out:      testDBOut{Name: "first", Count: 1},
+			Metadata: Metadata{CreatetAt: created, StartedAt: created, Status: TaskStatusSuccess, Tags: []string{"a"}},
+		}},
+		// no output and no start time are stored as NULL
+		{"second", Result[any]{
+			Err:      fmt.Errorf("%w: %w", ErrTaskTimedOut, context.DeadlineExceeded),
+			Metadata: Metadata{CreatetAt: created.Add(time.Hour), Status: TaskStatusTimedOut, Tags: []string{"a", "b"}},
+		}},
+		{"third", Result[any]{
+			Out:      testDBOut{Name: "third", Count: 3},
+			Metadata: Metadata{CreatetAt: created.Add(2 * time.Hour), Status: TaskStatusSuccess, Tags: []string{"b"}},
+		}},
+	}
+
+	dialects := []struct {
+		name    string
+		dialect Dialect
+	}{
+		{"sqlite", DialectSQLite},
+		{"postgres", DialectPostgres},
+		{"mysql", DialectMySQL},
+	}
+	for _, d := range dialects {
+		t.Run(d.name, func(t *testing.T) {
+			conn := sql.OpenDB(&testSQLDriver{})
+			defer conn.Close()
+			db, err := NewSQLDB(conn, d.dialect, "")
+			if err != nil {
+				t.Fatalf("NewSQLDB returned unexpected error: %v", err)
+			}
+			for _, r := range results {
+				if err := db.Write(r.id, r.result); err != nil {
+					t.Fatalf("unexpected error writing %s: %v", r.id, err)
+				}
+			}
+
+			result, err := ReadResult[testDBOut](db, "third")
+			if err != nil {
+				t.Fatalf("unexpected error reading the result: %v", err)
+			}
+			if result.Out != (testDBOut{Name: "third", Count: 3}) {
+				t.Errorf("unexpected result out: got %+v want %+v", result.Out, testDBOut{Name: "third", Count: 3})
+			}
+			if result.Err != nil {
+				t.Errorf("unexpected result error: %v", result.Err)
+			}
+			if result.Metadata.Status != TaskStatusSuccess || !result.Metadata.CreatetAt.Equal(created.Add(2*time.Hour)) {
+				t.Errorf("unexpected result metadata: got %+v", result.Metadata)
+			}
+
+			failed, err := ReadResult[testDBOut](db, "second")
+			if err != nil {
+				t.Fatalf("unexpected error reading the result: %v", err)
+			}
+			if failed.Out != (testDBOut{}) {
+				t.Errorf("unexpected result out: got %+v want the zero value", failed.Out)
+			}
+			if !errors.Is(failed.Err, ErrTaskTimedOut) || !errors.Is(failed.Err, context.DeadlineExceeded) {
+				t.Errorf("unexpected result error: got %v want %v", failed.Err, ErrTaskTimedOut)
+			}
+
+			tests := []struct {
+				name     string
+				filter   Filter
+				expected []string
+			}{
+				{"no filter", Filter{}, []string{"first", "second", "third"}},
+				{"status", Filter{Status: TaskStatusSuccess}, []string{"first", "third"}},
+				{"time range", Filter{From: created.Add(time.Hour), To: created.Add(2 * time.Hour)}, []string{"second"}},
+				{"tag", Filter{Tag: "b"}, []string{"second", "third"}},
+				{"status and tag", Filter{Status: TaskStatusSuccess, Tag: "a"}, []string{"first"}},
+				{"no match", Filter{Tag: "c"}, nil},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					records, err := ListResults[testDBOut](db, tt.filter)
+					if err != nil {
+						t.Fatalf("unexpected error listing the results: %v", err)
+					}
+					var ids []string
+					for _, rec := range records {
+						ids = append(ids, rec.ID)
+					}
+					if !slices.Equal(ids, tt.expected) {
+						t.Errorf("unexpected results: got %v want %v", ids, tt.expected)
+					}
+				})
+			}
+
+			if err := DeleteResult(db, "first"); err != nil {
+				t.Fatalf("unexpected error deleting the result: %v", err)
+			}
+			if _, err := ReadResult[testDBOut](db, "first"); !errors.Is(err, ErrResultNotFound) {
+				t.Errorf("unexpected error reading a deleted result: got %v want %v", err, ErrResultNotFound)
+			}
+			if _, err := ReadResult[testDBOut](db, "unknown"); !errors.Is(err, ErrResultNotFound) {
+				t.Errorf("unexpected error reading an unknown result: got %v want %v", err, ErrResultNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package iocast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryState describes the last failed attempt of a task to its retry policy.
+type RetryState struct {
+	// Attempt is the number of the attempt that failed, starting from 1.
+	Attempt int
+	// Err is the error returned by the failed attempt.
+	Err error
+	// Elapsed is the time passed since the first attempt started.
+	Elapsed time.Duration
+	// LastDelay is the delay that preceded the failed attempt, zero for the first one.
+	LastDelay time.Duration
+}
+
+// RetryPolicy decides whether and when a failed task is retried.
+type RetryPolicy interface {
+	// Next returns the delay before the next attempt, or false to stop retrying.
+	Next(s RetryState) (time.Duration, bool)
+}
+
+// RetryPolicyFunc adapts an ordinary function to a retry policy.
+type RetryPolicyFunc func(s RetryState) (time.Duration, bool)
+
+// Next calls f(s).
+func (f RetryPolicyFunc) Next(s RetryState) (time.Duration, bool) {
+	return f(s)
+}
+
+// Intervals is a retry policy that waits for the given intervals in order.
+// Attempts beyond the last interval keep waiting for the last one.
+type Intervals []time.Duration
+
+// Next returns the interval of the attempt.
+func (i Intervals) Next(s RetryState) (time.Duration, bool) {
+	if len(i) == 0 {
+		return 0, true
+	}
+	return i[min(s.Attempt, len(i))-1], true
+}
+
+// ConstantBackOff returns a retry policy that always waits for the same delay.
+func ConstantBackOff(delay time.Duration) RetryPolicy {
+	return RetryPolicyFunc(func(RetryState) (time.Duration, bool) {
+		return delay, true
+	})
+}
+
+// LinearBackOff returns a retry policy whose delay starts at initial and grows by increment on every attempt.
+func LinearBackOff(initial, increment time.Duration) RetryPolicy {
+	return RetryPolicyFunc(func(s RetryState) (time.Duration, bool) {
+		return initial + time.Duration(s.Attempt-1)*increment, true
+	})
+}
+
+// Jitter randomizes exponential backoff delays so that tasks failing together do not retry together.
+type Jitter int
+
+const (
+	// NoJitter waits for the exact exponential delay.
+	NoJitter Jitter = iota
+	// FullJitter waits for a random delay between zero and the exponential delay.
+	FullJitter
+	// EqualJitter waits for half the exponential delay plus a random delay up to the other half.
+	EqualJitter
+	// DecorrelatedJitter waits for a random delay between base and three times the previous delay.
+	DecorrelatedJitter
+)
+
+// ExponentialBackOff returns a retry policy whose delay starts at base and doubles on every attempt.
+func ExponentialBackOff(base time.Duration, jitter Jitter) RetryPolicy {
+	return RetryPolicyFunc(func(s RetryState) (time.Duration, bool) {
+		if jitter == DecorrelatedJitter {
+			upper := max(base, 3*s.LastDelay)
+			if s.LastDelay > math.MaxInt64/3 {
+				upper = math.MaxInt64
+			}
+			return base + randDuration(upper-base), true
+		}
+
+		delay := base
+		for i := 1; i < s.Attempt; i++ {
+			if delay > math.MaxInt64/2 {
+				delay = math.MaxInt64
+				break
+			}
+			delay *= 2
+		}
+		switch jitter {
+		case FullJitter:
+			delay = randDuration(delay)
+		case EqualJitter:
+			delay = delay/2 + randDuration(delay-delay/2)
+		}
+		return delay, true
+	})
+}
+
+// randDuration returns a random duration in [0, d].
+func randDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	if d == math.MaxInt64 {
+		return time.Duration(rand.Int64())
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
+
+// MaxDelay caps the delays of the given retry policy.
+func MaxDelay(p RetryPolicy, maxDelay time.Duration) RetryPolicy {
+	return RetryPolicyFunc(func(s RetryState) (time.Duration, bool) {
+		delay, ok := p.Next(s)
+		return min(delay, maxDelay), ok
+	})
+}
+
+// MaxElapsed stops the given retry policy once the next attempt would start after maxElapsed since the first one.
+func MaxElapsed(p RetryPolicy, maxElapsed time.Duration) RetryPolicy {
+	return RetryPolicyFunc(func(s RetryState) (time.Duration, bool) {
+		delay, ok := p.Next(s)
+		if !ok || s.Elapsed+delay > maxElapsed {
+			return 0, false
+		}
+		return delay, true
+	})
+}
+
+// PermanentError wraps an error that must not be retried.
+type PermanentError struct {
+	Err error
+}
+
+// Permanent wraps the error so that the task fails without any further retries.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterError wraps an error that must be retried after a specific delay.
+type RetryAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+// RetryAfter wraps the error so that the next attempt waits for the given delay instead of
+// the one of the retry policy, e.g. when a rate limited API says when to come back.
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryAfterError{Err: err, Delay: delay}
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is the error of an attempt that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+// Unwrap returns the value the task panicked with, if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// isRetryable reports whether the error is worth retrying according to the error itself and the given predicate.
+func isRetryable(err error, retryIf func(error) bool) bool {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	return retryIf == nil || retryIf(err)
+}
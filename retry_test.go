@@ -0,0 +1,155 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		state    RetryState
+		expected time.Duration
+		ok       bool
+	}{
+		{"constant", ConstantBackOff(time.Second), RetryState{Attempt: 5}, time.Second, true},
+		{"linear", LinearBackOff(time.Second, 2*time.Second), RetryState{Attempt: 3}, 5 * time.Second, true},
+		{"exponential first", ExponentialBackOff(time.Second, NoJitter), RetryState{Attempt: 1}, time.Second, true},
+		{"exponential", ExponentialBackOff(time.Second, NoJitter), RetryState{Attempt: 4}, 8 * time.Second, true},
+		{"exponential overflow", ExponentialBackOff(time.Second, NoJitter), RetryState{Attempt: 200}, math.MaxInt64, true},
+		{"intervals", Intervals{time.Second, 2 * time.Second}, RetryState{Attempt: 2}, 2 * time.Second, true},
+		{"intervals beyond last", Intervals{time.Second, 2 * time.Second}, RetryState{Attempt: 5}, 2 * time.Second, true},
+		{"max delay", MaxDelay(ExponentialBackOff(time.Second, NoJitter), 3*time.Second), RetryState{Attempt: 4}, 3 * time.Second, true},
+		{"max elapsed", MaxElapsed(ConstantBackOff(time.Second), 5*time.Second), RetryState{Attempt: 2, Elapsed: 3 * time.Second}, time.Second, true},
+		{"max elapsed exceeded", MaxElapsed(ConstantBackOff(time.Second), 5*time.Second), RetryState{Attempt: 2, Elapsed: 4500 * time.Millisecond}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := tt.policy.Next(tt.state)
+			if ok != tt.ok {
+				t.Errorf("Next returned unexpected ok: got %v want %v", ok, tt.ok)
+			}
+			if delay != tt.expected {
+				t.Errorf("Next returned unexpected delay: got %v want %v", delay, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		state    RetryState
+		min, max time.Duration
+	}{
+		{"full", ExponentialBackOff(time.Second, FullJitter), RetryState{Attempt: 3}, 0, 4 * time.Second},
+		{"equal", ExponentialBackOff(time.Second, EqualJitter), RetryState{Attempt: 3}, 2 * time.Second, 4 * time.Second},
+		{"decorrelated", ExponentialBackOff(time.Second, DecorrelatedJitter), RetryState{Attempt: 3, LastDelay: 2 * time.Second}, time.Second, 6 * time.Second},
+		{"decorrelated first", ExponentialBackOff(time.Second, DecorrelatedJitter), RetryState{Attempt: 1}, time.Second, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				delay, ok := tt.policy.Next(tt.state)
+				if !ok {
+					t.Fatal("Next unexpectedly stopped retrying")
+				}
+				if delay < tt.min || delay > tt.max {
+					t.Fatalf("Next returned delay out of range: got %v want [%v, %v]", delay, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestTaskRetryPolicy(t *testing.T) {
+	attempts := 0
+	taskFn := NewTaskFunc(context.Background(), "args", func(_ context.Context, _ string) (string, error) {
+		attempts++
+		return "", errors.New("something went wrong")
+	})
+
+	stopAfterTwo := RetryPolicyFunc(func(s RetryState) (time.Duration, bool) {
+		return time.Millisecond, s.Attempt < 2
+	})
+	task := TaskBuilder("uuid", taskFn).MaxRetries(5).RetryPolicy(stopAfterTwo).Build()
+
+	task.Exec(context.Background())
+	<-task.Wait()
+
+	if attempts != 2 {
+		t.Errorf("unexpected total attempts made: got %v want %v", attempts, 2)
+	}
+}
+
+func TestTaskRetryableErrors(t *testing.T) {
+	errValidation := errors.New("validation failed")
+	errRateLimited := errors.New("rate limited")
+
+	tests := []struct {
+		name     string
+		err      error
+		target   error
+		retryIf  func(error) bool
+		expected int
+	}{
+		{"retryable", errRateLimited, errRateLimited, nil, 4},
+		{"permanent", Permanent(errValidation), errValidation, nil, 1},
+		{"wrapped permanent", fmt.Errorf("calling api: %w", Permanent(errValidation)), errValidation, nil, 1},
+		{"not matching retry if", errValidation, errValidation, func(err error) bool { return errors.Is(err, errRateLimited) }, 1},
+		{"matching retry if", errRateLimited, errRateLimited, func(err error) bool { return errors.Is(err, errRateLimited) }, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			taskFn := NewTaskFunc(context.Background(), "args", func(_ context.Context, _ string) (string, error) {
+				attempts++
+				return "", tt.err
+			})
+			task := TaskBuilder("uuid", taskFn).MaxRetries(3).RetryIf(tt.retryIf).Build()
+
+			task.Exec(context.Background())
+			result := <-task.Wait()
+
+			if attempts != tt.expected {
+				t.Errorf("unexpected total attempts made: got %v want %v", attempts, tt.expected)
+			}
+			if !errors.Is(result.Err, tt.target) {
+				t.Errorf("unexpected result error: got %v want %v", result.Err, tt.target)
+			}
+		})
+	}
+}
+
+func TestTaskRetryAfter(t *testing.T) {
+	attempts := 0
+	taskFn := NewTaskFunc(context.Background(), "args", func(_ context.Context, _ string) (string, error) {
+		attempts++
+		if attempts == 1 {
+			return "", RetryAfter(errors.New("rate limited"), 50*time.Millisecond)
+		}
+		return "ok", nil
+	})
+	task := TaskBuilder("uuid", taskFn).MaxRetries(1).BackOff([]time.Duration{time.Hour}).Build()
+
+	start := time.Now()
+	task.Exec(context.Background())
+	result := <-task.Wait()
+	elapsed := time.Since(start)
+
+	if result.Err != nil {
+		t.Errorf("unexpected result error: %v", result.Err)
+	}
+	if elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("RetryAfter delay was not honoured: retried after %v", elapsed)
+	}
+}
@@ -0,0 +1,390 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	// DefaultQueue is the router queue of the tasks that do not name one.
+	DefaultQueue = "default"
+)
+
+var (
+	ErrUnknownQueue        = errors.New("unknown queue")
+	ErrQueueAlreadyExists  = errors.New("queue already exists")
+	ErrInvalidQueueOptions = errors.New("invalid queue options")
+)
+
+// RouterStrategy decides which of the queues of a router a worker takes its next job from.
+type RouterStrategy int
+
+const (
+	// RoundRobin takes turns between the queues in the order they were added.
+	RoundRobin RouterStrategy = iota
+	// WeightedRoundRobin takes turns between the queues in proportion to their weights.
+	WeightedRoundRobin
+)
+
+// QueueOptions configures a named queue of a router.
+type QueueOptions struct {
+	// Workers is the maximum number of jobs of the queue running at once, zero means no limit.
+	Workers int
+	// Capacity is the maximum number of jobs waiting in the queue. Unlike with a worker
+	// pool's own queue, jobs are never handed off beyond it, so it must be positive.
+	Capacity int
+	// Weight is the share of turns the queue gets with WeightedRoundRobin, it defaults to 1.
+	Weight int
+	// MaxRetries and RetryPolicy are the retry defaults of the tasks of the queue that
+	// were built without their own.
+	MaxRetries  int
+	RetryPolicy RetryPolicy
+}
+
+type routerQueue struct {
+	name    string
+	opts    QueueOptions
+	mem     *MemQueue
+	running int
+	paused  bool
+	// current is the running score of the queue with WeightedRoundRobin.
+	current int
+}
+
+// runnable reports whether a job of the queue can be popped, paused queues are
+// still drained once the router is closed.
+func (rq *routerQueue) runnable(closed bool) bool {
+	return rq.runnableLen(closed) > 0
+}
+
+// runnableLen returns the number of jobs of the queue that can be popped right away,
+// leaving out those held back by the queue being paused or by its workers limit.
+func (rq *routerQueue) runnableLen(closed bool) int {
+	if rq.paused && !closed {
+		return 0
+	}
+	n := rq.mem.Len()
+	if rq.opts.Workers > 0 {
+		n = min(n, max(rq.opts.Workers-rq.running, 0))
+	}
+	return n
+}
+
+// Router is a queue made of named queues, each with its own capacity, concurrency
+// limit and retry defaults. Jobs are pushed to the queue named by their task's Queue,
+// and the workers of the pool the router backs take turns between the queues
+// according to the router's strategy. Queues can be paused and resumed.
+type Router struct {
+	mu       sync.Mutex
+	strategy RouterStrategy
+	queues   []*routerQueue
+	byName   map[string]*routerQueue
+	jobs     map[Job]*routerQueue
+	next     int
+	closed   bool
+	notEmpty chan struct{}
+	notFull  chan struct{}
+}
+
+// NewRouter creates and returns a new router without any queues.
+func NewRouter(strategy RouterStrategy) *Router {
+	return &Router{
+		strategy: strategy,
+		byName:   make(map[string]*routerQueue),
+		jobs:     make(map[Job]*routerQueue),
+		notEmpty: make(chan struct{}),
+	}
+}
+
+// AddQueue adds a named queue to the router. It returns ErrInvalidQueueOptions if the
+// queue's capacity is not positive or its workers limit is negative.
+func (r *Router) AddQueue(name string, opts QueueOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byName[name]; ok {
+		return fmt.Errorf("%w: %s", ErrQueueAlreadyExists, name)
+	}
+	if opts.Capacity < 1 {
+		return fmt.Errorf("%w: %s has capacity %d", ErrInvalidQueueOptions, name, opts.Capacity)
+	}
+	if opts.Workers < 0 {
+		return fmt.Errorf("%w: %s has workers limit %d", ErrInvalidQueueOptions, name, opts.Workers)
+	}
+	if opts.Weight < 1 {
+		opts.Weight = 1
+	}
+	rq := &routerQueue{
+		name: name,
+		opts: opts,
+		mem:  NewMemQueue(opts.Capacity),
+	}
+	r.queues = append(r.queues, rq)
+	r.byName[name] = rq
+	return nil
+}
+
+// Pause stops the workers from taking jobs from the named queue, jobs can still be pushed to it.
+func (r *Router) Pause(name string) error {
+	return r.setPaused(name, true)
+}
+
+// Resume lets the workers take jobs from the named queue again.
+func (r *Router) Resume(name string) error {
+	return r.setPaused(name, false)
+}
+
+func (r *Router) setPaused(name string, paused bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rq, ok := r.byName[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownQueue, name)
+	}
+	rq.paused = paused
+	if !paused {
+		r.signal()
+	}
+	return nil
+}
+
+// Paused reports whether the named queue is paused.
+func (r *Router) Paused(name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rq, ok := r.byName[name]
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrUnknownQueue, name)
+	}
+	return rq.paused, nil
+}
+
+// QueueLen returns the number of jobs waiting in the named queue.
+func (r *Router) QueueLen(name string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rq, ok := r.byName[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownQueue, name)
+	}
+	return rq.mem.Len(), nil
+}
+
+// Push adds the job to the queue named by its task, or DefaultQueue if it names none.
+// It returns ErrUnknownQueue if the router has no such queue.
+func (r *Router) Push(j Job) error {
+	name := DefaultQueue
+	if rt, ok := j.(routed); ok && rt.queueName() != "" {
+		name = rt.queueName()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrQueueClosed
+	}
+	rq, ok := r.byName[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownQueue, name)
+	}
+	if d, ok := j.(retryDefaulter); ok {
+		d.applyRetryDefaults(rq.opts.MaxRetries, rq.opts.RetryPolicy)
+	}
+	if err := rq.mem.Push(j); err != nil {
+		return fmt.Errorf("%w: %s", err, name)
+	}
+	r.signal()
+	return nil
+}
+
+// signal wakes up the consumers waiting on the router, must be called with the lock held.
+func (r *Router) signal() {
+	close(r.notEmpty)
+	r.notEmpty = make(chan struct{})
+}
+
+// space returns a channel that is closed the next time a queue of the router may have room for a job.
+func (r *Router) space() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.notFull == nil {
+		r.notFull = make(chan struct{})
+	}
+	return r.notFull
+}
+
+// signalSpace wakes up the producers waiting for room in the router, must be called with the lock held.
+func (r *Router) signalSpace() {
+	if r.notFull != nil {
+		close(r.notFull)
+		r.notFull = nil
+	}
+}
+
+// Pop blocks until a queue has a job that can run and returns it, taking turns between the queues.
+func (r *Router) Pop(ctx context.Context) (Job, error) {
+	r.mu.Lock()
+	for {
+		if rq := r.pick(); rq != nil {
+			// The queue has a job, so popping it does not block.
+			j, err := rq.mem.Pop(ctx)
+			if err != nil {
+				r.mu.Unlock()
+				return nil, err
+			}
+			rq.running++
+			r.jobs[j] = rq
+			r.signalSpace()
+			r.mu.Unlock()
+			return j, nil
+		}
+		if r.closed && r.drained() {
+			r.mu.Unlock()
+			return nil, ErrQueueClosed
+		}
+		notEmpty := r.notEmpty
+		r.mu.Unlock()
+
+		select {
+		case <-notEmpty:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		r.mu.Lock()
+	}
+}
+
+// pick returns the queue to take the next job from according to the strategy, or nil if
+// no queue has a job that can run. It must be called with the lock held.
+func (r *Router) pick() *routerQueue {
+	switch r.strategy {
+	case WeightedRoundRobin:
+		// Smooth weighted round-robin: every runnable queue gains its weight and the
+		// one with the highest score is picked and loses the total weight.
+		var best *routerQueue
+		total := 0
+		for _, rq := range r.queues {
+			if !rq.runnable(r.closed) {
+				continue
+			}
+			rq.current += rq.opts.Weight
+			total += rq.opts.Weight
+			if best == nil || rq.current > best.current {
+				best = rq
+			}
+		}
+		if best != nil {
+			best.current -= total
+		}
+		return best
+	default:
+		for i := range r.queues {
+			idx := (r.next + i) % len(r.queues)
+			if rq := r.queues[idx]; rq.runnable(r.closed) {
+				r.next = idx + 1
+				return rq
+			}
+		}
+		return nil
+	}
+}
+
+// drained reports whether every queue of the router is empty, must be called with the lock held.
+func (r *Router) drained() bool {
+	for _, rq := range r.queues {
+		if rq.mem.Len() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// done frees the slot of a popped job in its queue.
+func (r *Router) done(j Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rq, ok := r.jobs[j]
+	if !ok {
+		return fmt.Errorf("job %s is not queued", j.ID())
+	}
+	delete(r.jobs, j)
+	rq.running--
+	r.signal()
+	return nil
+}
+
+// Start is a no-op, the router's queues are in memory.
+func (r *Router) Start(Job) error {
+	return nil
+}
+
+// Ack frees the slot of the finished job in its queue.
+func (r *Router) Ack(j Job) error {
+	return r.done(j)
+}
+
+// release frees the slot of a job that did not complete.
+func (r *Router) release(j Job) error {
+	return r.done(j)
+}
+
+// Len returns the number of jobs waiting in all the queues of the router.
+func (r *Router) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, rq := range r.queues {
+		n += rq.mem.Len()
+	}
+	return n
+}
+
+// runnableLen returns the number of jobs waiting in the queues of the router that the
+// workers can take right away.
+func (r *Router) runnableLen() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, rq := range r.queues {
+		n += rq.runnableLen(r.closed)
+	}
+	return n
+}
+
+// Depth returns the number of jobs waiting at each priority in all the queues of the router.
+func (r *Router) Depth() map[int]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	depth := make(map[int]int)
+	for _, rq := range r.queues {
+		for priority, n := range rq.mem.Depth() {
+			depth[priority] += n
+		}
+	}
+	return depth
+}
+
+// Close stops the router from accepting new jobs and wakes up any waiting consumers.
+// The jobs of paused queues are drained too.
+func (r *Router) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	for _, rq := range r.queues {
+		rq.mem.Close()
+	}
+	r.signal()
+	r.signalSpace()
+	return nil
+}
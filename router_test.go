@@ -0,0 +1,167 @@
+package iocast
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRouter(t *testing.T) {
+	r := NewRouter(RoundRobin)
+	if err := r.AddQueue("emails", QueueOptions{Workers: 2, Capacity: 4, MaxRetries: 3}); err != nil {
+		t.Fatalf("AddQueue returned unexpected error: %v", err)
+	}
+	if err := r.AddQueue("emails", QueueOptions{}); !errors.Is(err, ErrQueueAlreadyExists) {
+		t.Errorf("AddQueue returned unexpected error: got %v want %v", err, ErrQueueAlreadyExists)
+	}
+	for _, opts := range []QueueOptions{{Capacity: 0}, {Capacity: -1}, {Workers: -1, Capacity: 4}} {
+		if err := r.AddQueue("invalid", opts); !errors.Is(err, ErrInvalidQueueOptions) {
+			t.Errorf("AddQueue returned unexpected error for %+v: got %v want %v", opts, err, ErrInvalidQueueOptions)
+		}
+	}
+
+	p := NewWorkerPoolWithQueue(2, r)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	attempts := 0
+	flaky := func(_ context.Context, args string) (string, error) {
+		attempts++
+		if attempts < 3 {
+			return "", errors.New("flaky")
+		}
+		return args, nil
+	}
+	taskFn := NewTaskFunc(context.Background(), "args", flaky)
+
+	tests := []struct {
+		name     string
+		task     *Task[string]
+		err      error
+		attempts int
+	}{
+		{"queue retry defaults", TaskBuilder("defaults", taskFn).Queue("emails").Build(), nil, 3},
+		{"own retries", TaskBuilder("own", taskFn).Queue("emails").MaxRetries(1).Build(), nil, 2},
+		{"unknown queue", TaskBuilder("unknown", taskFn).Queue("reports").Build(), ErrUnknownQueue, 0},
+		{"no default queue", TaskBuilder("default", taskFn).Build(), ErrUnknownQueue, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts = 0
+			err := p.Enqueue(tt.task)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Enqueue returned unexpected error: got %v want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			result := <-tt.task.Wait()
+			if len(result.Metadata.Attempts) != tt.attempts {
+				t.Errorf("unexpected number of attempts: got %v want %v", len(result.Metadata.Attempts), tt.attempts)
+			}
+			if result.Metadata.Queue != "emails" {
+				t.Errorf("unexpected queue: got %v want %v", result.Metadata.Queue, "emails")
+			}
+		})
+	}
+}
+
+func TestRouterStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy RouterStrategy
+		expected []string
+	}{
+		{"round robin", RoundRobin, []string{"a1", "b1", "a2", "b2", "a3", "b3", "a4", "b4"}},
+		{"weighted round robin", WeightedRoundRobin, []string{"a1", "b1", "a2", "a3", "b2", "a4", "b3", "b4"}},
+	}
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(tt.strategy)
+			r.AddQueue("a", QueueOptions{Capacity: 4, Weight: 2})
+			r.AddQueue("b", QueueOptions{Capacity: 4, Weight: 1})
+			for _, id := range []string{"a1", "a2", "a3", "a4", "b1", "b2", "b3", "b4"} {
+				if err := r.Push(TaskBuilder(id, taskFn).Queue(id[:1]).Build()); err != nil {
+					t.Fatalf("Push returned unexpected error: %v", err)
+				}
+			}
+
+			for _, expected := range tt.expected {
+				j, err := r.Pop(context.Background())
+				if err != nil {
+					t.Fatalf("Pop returned unexpected error: %v", err)
+				}
+				if j.ID() != expected {
+					t.Errorf("Pop returned jobs out of order: got %v want %v", j.ID(), expected)
+				}
+				r.Ack(j)
+			}
+		})
+	}
+}
+
+func TestRouterPauseAndConcurrency(t *testing.T) {
+	r := NewRouter(RoundRobin)
+	r.AddQueue("imports", QueueOptions{Workers: 1, Capacity: 4})
+	r.AddQueue(DefaultQueue, QueueOptions{Capacity: 4})
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	for _, id := range []string{"import1", "import2"} {
+		r.Push(TaskBuilder(id, taskFn).Queue("imports").Build())
+	}
+	r.Push(TaskBuilder("other", taskFn).Build())
+
+	pop := func(expected string) Job {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		j, err := r.Pop(ctx)
+		if expected == "" {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Pop returned unexpected error: got %v want %v", err, context.DeadlineExceeded)
+			}
+			return nil
+		}
+		if err != nil {
+			t.Fatalf("Pop returned unexpected error: %v", err)
+		}
+		if j.ID() != expected {
+			t.Errorf("Pop returned unexpected job: got %v want %v", j.ID(), expected)
+		}
+		return j
+	}
+
+	// the second import waits for the first one to finish
+	first := pop("import1")
+	pop("other")
+	pop("")
+	r.Ack(first)
+
+	if err := r.Pause("imports"); err != nil {
+		t.Fatalf("Pause returned unexpected error: %v", err)
+	}
+	pop("")
+	if n, _ := r.QueueLen("imports"); n != 1 {
+		t.Errorf("unexpected queue length: got %v want %v", n, 1)
+	}
+	if err := r.Resume("imports"); err != nil {
+		t.Fatalf("Resume returned unexpected error: %v", err)
+	}
+	r.Ack(pop("import2"))
+
+	// a closed router drains its paused queues
+	r.Push(TaskBuilder("import3", taskFn).Queue("imports").Build())
+	r.Pause("imports")
+	r.Close()
+	pop("import3")
+	if _, err := r.Pop(context.Background()); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Pop returned unexpected error: got %v want %v", err, ErrQueueClosed)
+	}
+	if err := r.Pause("reports"); !errors.Is(err, ErrUnknownQueue) {
+		t.Errorf("Pause returned unexpected error: got %v want %v", err, ErrUnknownQueue)
+	}
+}
@@ -0,0 +1,303 @@
+package iocast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	scheduleOpStore  = "store"
+	scheduleOpDelete = "delete"
+)
+
+var (
+	ErrScheduleStoreClosed = errors.New("schedule store is closed")
+)
+
+// JobCodec encodes jobs so they can be persisted and decodes them back into runnable jobs.
+type JobCodec interface {
+	EncodeJob(Job) ([]byte, error)
+	DecodeJob([]byte) (Job, error)
+}
+
+type scheduleRecord struct {
+	Op         string    `json:"op"`
+	ID         string    `json:"id"`
+	RunAt      time.Time `json:"run_at,omitempty"`
+	Recurrence string    `json:"recurrence,omitempty"`
+	Job        []byte    `json:"job,omitempty"`
+}
+
+type fileSchedule struct {
+	schedule *Schedule
+	job      []byte
+}
+
+// ScheduleFileDB is a durable schedule store backed by an append-only log file.
+// Every change is appended and synced to disk, and the log is compacted once
+// superseded records outnumber the live ones.
+type ScheduleFileDB struct {
+	mu        sync.Mutex
+	path      string
+	codec     JobCodec
+	file      *os.File
+	schedules map[string]*fileSchedule
+	// undecoded holds the records of the schedules the codec could not decode, e.g.
+	// because their handler is not registered by this process, so that compaction keeps them.
+	undecoded map[string]scheduleRecord
+	records   int
+}
+
+// NewScheduleFileDB opens the schedule log at path, creating it if needed, and restores the schedules it holds.
+func NewScheduleFileDB(path string, codec JobCodec) (*ScheduleFileDB, error) {
+	m := &ScheduleFileDB{
+		path:      path,
+		codec:     codec,
+		schedules: make(map[string]*fileSchedule),
+		undecoded: make(map[string]scheduleRecord),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.compact(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *ScheduleFileDB) load() error {
+	records := make(map[string]scheduleRecord)
+	var order []string
+	err := readLog(m.path, func(rec scheduleRecord) {
+		switch rec.Op {
+		case scheduleOpStore:
+			if _, ok := records[rec.ID]; !ok {
+				order = append(order, rec.ID)
+			}
+			records[rec.ID] = rec
+		case scheduleOpDelete:
+			delete(records, rec.ID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		rec, ok := records[id]
+		if !ok {
+			continue
+		}
+		schedule, err := m.decode(rec)
+		if err != nil {
+			log.Printf("skipping schedule %s: %v", id, err)
+			m.undecoded[id] = rec
+			continue
+		}
+		m.schedules[id] = &fileSchedule{schedule: schedule, job: rec.Job}
+	}
+	return nil
+}
+
+func (m *ScheduleFileDB) decode(rec scheduleRecord) (*Schedule, error) {
+	schedule := &Schedule{
+		ID:    rec.ID,
+		RunAt: rec.RunAt,
+	}
+	if rec.Recurrence == "" {
+		j, err := m.codec.DecodeJob(rec.Job)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding job: %w", err)
+		}
+		schedule.job = j
+		return schedule, nil
+	}
+
+	r, err := Cron(rec.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.codec.DecodeJob(rec.Job); err != nil {
+		return nil, fmt.Errorf("error decoding job: %w", err)
+	}
+	data := rec.Job
+	schedule.Recurrence = r
+	schedule.factory = func() Job {
+		j, err := m.codec.DecodeJob(data)
+		if err != nil {
+			log.Printf("error decoding job of schedule %s: %v", rec.ID, err)
+			return nil
+		}
+		return j
+	}
+	return schedule, nil
+}
+
+// Store persists the schedule. Recurring schedules are persisted with the job
+// their factory produces on the first call, which is reused when they are re-armed.
+func (m *ScheduleFileDB) Store(id string, s *Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file == nil {
+		return ErrScheduleStoreClosed
+	}
+
+	var data []byte
+	if existing, ok := m.schedules[id]; ok && existing.schedule.first() == s.first() {
+		data = existing.job
+	} else {
+		j := s.nextJob()
+		if j == nil {
+			return fmt.Errorf("schedule %s has no job", id)
+		}
+		var err error
+		data, err = m.codec.EncodeJob(j)
+		if err != nil {
+			return fmt.Errorf("error encoding job: %w", err)
+		}
+	}
+
+	rec := scheduleRecord{
+		Op:    scheduleOpStore,
+		ID:    id,
+		RunAt: s.RunAt,
+		Job:   data,
+	}
+	if s.Recurrence != nil {
+		rec.Recurrence = s.Recurrence.String()
+	}
+	if err := m.append(rec); err != nil {
+		return err
+	}
+	m.schedules[id] = &fileSchedule{schedule: s, job: data}
+	delete(m.undecoded, id)
+	return m.maybeCompact()
+}
+
+// Delete removes a schedule from the database.
+func (m *ScheduleFileDB) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file == nil {
+		return ErrScheduleStoreClosed
+	}
+	_, ok := m.schedules[id]
+	_, undecoded := m.undecoded[id]
+	if !ok && !undecoded {
+		return nil
+	}
+	if err := m.append(scheduleRecord{Op: scheduleOpDelete, ID: id}); err != nil {
+		return err
+	}
+	delete(m.schedules, id)
+	delete(m.undecoded, id)
+	return m.maybeCompact()
+}
+
+// FetchDue fetches the due schedules from the database.
+func (m *ScheduleFileDB) FetchDue(now time.Time) ([]*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var dueSchedules []*Schedule
+	for _, fs := range m.schedules {
+		if !fs.schedule.RunAt.After(now) {
+			dueSchedules = append(dueSchedules, fs.schedule.clone())
+		}
+	}
+	return dueSchedules, nil
+}
+
+// List returns all the schedules in the database.
+func (m *ScheduleFileDB) List() ([]*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules := make([]*Schedule, 0, len(m.schedules))
+	for _, fs := range m.schedules {
+		schedules = append(schedules, fs.schedule.clone())
+	}
+	return schedules, nil
+}
+
+// Compact rewrites the log so it only holds the live schedules.
+func (m *ScheduleFileDB) Compact() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file == nil {
+		return ErrScheduleStoreClosed
+	}
+	return m.compact()
+}
+
+// Close closes the underlying log file.
+func (m *ScheduleFileDB) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file == nil {
+		return nil
+	}
+	err := m.file.Close()
+	m.file = nil
+	return err
+}
+
+func (m *ScheduleFileDB) append(rec scheduleRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := m.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := m.file.Sync(); err != nil {
+		return err
+	}
+	m.records++
+	return nil
+}
+
+func (m *ScheduleFileDB) maybeCompact() error {
+	if m.records >= minCompactionRecords && m.records > 2*(len(m.schedules)+len(m.undecoded)) {
+		return m.compact()
+	}
+	return nil
+}
+
+// compact rewrites the log so it only holds the live schedules.
+func (m *ScheduleFileDB) compact() error {
+	records := make([]scheduleRecord, 0, len(m.schedules)+len(m.undecoded))
+	for id, fs := range m.schedules {
+		rec := scheduleRecord{
+			Op:    scheduleOpStore,
+			ID:    id,
+			RunAt: fs.schedule.RunAt,
+			Job:   fs.job,
+		}
+		if fs.schedule.Recurrence != nil {
+			rec.Recurrence = fs.schedule.Recurrence.String()
+		}
+		records = append(records, rec)
+	}
+	for _, rec := range m.undecoded {
+		records = append(records, rec)
+	}
+	file, err := rewriteLog(m.path, m.file, records)
+	m.file = file
+	if err != nil {
+		return err
+	}
+	m.records = len(records)
+	return nil
+}
@@ -0,0 +1,240 @@
+package iocast
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testJobCodec struct{}
+
+func (testJobCodec) EncodeJob(j Job) ([]byte, error) {
+	return []byte(j.ID()), nil
+}
+
+func (testJobCodec) DecodeJob(data []byte) (Job, error) {
+	taskFn := NewTaskFunc(context.Background(), string(data), testTaskFn)
+	return TaskBuilder(string(data), taskFn).Build(), nil
+}
+
+func TestScheduleFileDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.log")
+
+	db, err := NewScheduleFileDB(path, testJobCodec{})
+	if err != nil {
+		t.Fatalf("NewScheduleFileDB returned unexpected error: %v", err)
+	}
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	runAt := time.Now().Add(time.Hour).UTC()
+
+	err = db.Store("once", &Schedule{ID: "once", RunAt: runAt, job: TaskBuilder("once", taskFn).Build()})
+	if err != nil {
+		t.Fatalf("Store returned unexpected error: %v", err)
+	}
+	err = db.Store("periodic", &Schedule{
+		ID:         "periodic",
+		RunAt:      runAt,
+		Recurrence: Every(time.Minute),
+		factory:    func() Job { return TaskBuilder("periodic", taskFn).Build() },
+	})
+	if err != nil {
+		t.Fatalf("Store returned unexpected error: %v", err)
+	}
+	err = db.Store("deleted", &Schedule{ID: "deleted", RunAt: runAt, job: TaskBuilder("deleted", taskFn).Build()})
+	if err != nil {
+		t.Fatalf("Store returned unexpected error: %v", err)
+	}
+	if err := db.Delete("deleted"); err != nil {
+		t.Fatalf("Delete returned unexpected error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close returned unexpected error: %v", err)
+	}
+
+	db, err = NewScheduleFileDB(path, testJobCodec{})
+	if err != nil {
+		t.Fatalf("NewScheduleFileDB returned unexpected error: %v", err)
+	}
+	defer db.Close()
+
+	schedules, err := db.List()
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %v", err)
+	}
+	if len(schedules) != 2 {
+		t.Fatalf("List returned unexpected number of schedules: got %v want %v", len(schedules), 2)
+	}
+
+	due, err := db.FetchDue(runAt.Add(time.Second))
+	if err != nil {
+		t.Fatalf("FetchDue returned unexpected error: %v", err)
+	}
+	if len(due) != 2 {
+		t.Fatalf("FetchDue returned unexpected number of schedules: got %v want %v", len(due), 2)
+	}
+	for _, s := range due {
+		if !s.RunAt.Equal(runAt) {
+			t.Errorf("restored schedule has wrong run time: got %v want %v", s.RunAt, runAt)
+		}
+		j := s.nextJob()
+		if j == nil || j.ID() != s.ID {
+			t.Errorf("restored schedule %s has wrong job: %v", s.ID, j)
+		}
+		if s.ID == "periodic" && s.Recurrence.String() != "@every 1m0s" {
+			t.Errorf("restored schedule has wrong recurrence: got %v want %v", s.Recurrence, "@every 1m0s")
+		}
+	}
+
+	due, err = db.FetchDue(time.Now())
+	if err != nil {
+		t.Fatalf("FetchDue returned unexpected error: %v", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("FetchDue returned unexpected number of schedules: got %v want %v", len(due), 0)
+	}
+}
+
+// testFailingJobCodec cannot decode any job, like a process missing their handlers.
+type testFailingJobCodec struct {
+	testJobCodec
+}
+
+func (testFailingJobCodec) DecodeJob([]byte) (Job, error) {
+	return nil, ErrTaskNotRegistered
+}
+
+func TestScheduleFileDBUndecodableSchedules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.log")
+
+	db, err := NewScheduleFileDB(path, testJobCodec{})
+	if err != nil {
+		t.Fatalf("NewScheduleFileDB returned unexpected error: %v", err)
+	}
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	runAt := time.Now().Add(time.Hour).UTC()
+	for _, id := range []string{"kept", "deleted"} {
+		if err := db.Store(id, &Schedule{ID: id, RunAt: runAt, job: TaskBuilder(id, taskFn).Build()}); err != nil {
+			t.Fatalf("Store returned unexpected error: %v", err)
+		}
+	}
+	db.Close()
+
+	// a process that cannot decode the schedules keeps them in the log
+	db, err = NewScheduleFileDB(path, testFailingJobCodec{})
+	if err != nil {
+		t.Fatalf("NewScheduleFileDB returned unexpected error: %v", err)
+	}
+	if schedules, _ := db.List(); len(schedules) != 0 {
+		t.Errorf("unexpected number of schedules: got %v want %v", len(schedules), 0)
+	}
+	if err := db.Delete("deleted"); err != nil {
+		t.Fatalf("Delete returned unexpected error: %v", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact returned unexpected error: %v", err)
+	}
+	db.Close()
+
+	db, err = NewScheduleFileDB(path, testJobCodec{})
+	if err != nil {
+		t.Fatalf("NewScheduleFileDB returned unexpected error: %v", err)
+	}
+	defer db.Close()
+	schedules, _ := db.List()
+	if len(schedules) != 1 || schedules[0].ID != "kept" {
+		t.Errorf("unexpected schedules: got %v want %v", schedules, []string{"kept"})
+	}
+}
+
+func TestSchedulerWithScheduleFileDB(t *testing.T) {
+	p := NewWorkerPool(1, 1)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	db, err := NewScheduleFileDB(filepath.Join(t.TempDir(), "schedules.log"), testJobCodec{})
+	if err != nil {
+		t.Fatalf("NewScheduleFileDB returned unexpected error: %v", err)
+	}
+	defer db.Close()
+
+	s := NewScheduler(p, db, 10*time.Millisecond)
+	defer s.Stop()
+
+	s.Dispatch()
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	task := TaskBuilder("uuid", taskFn).Build()
+
+	err = s.Schedule(task, time.Now().Add(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Schedule returned unexpected error: %v", err)
+	}
+
+	result := <-task.Wait()
+	if result.Out != "args" {
+		t.Errorf("wrong result output: got %v want %v", result.Out, "args")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	schedules, _ := db.List()
+	if len(schedules) != 0 {
+		t.Errorf("dispatched schedule was not deleted: got %v schedules", len(schedules))
+	}
+}
+
+// testCountingJobCodec counts the jobs it encodes.
+type testCountingJobCodec struct {
+	testJobCodec
+	encoded *atomic.Int32
+}
+
+func (c testCountingJobCodec) EncodeJob(j Job) ([]byte, error) {
+	c.encoded.Add(1)
+	return c.testJobCodec.EncodeJob(j)
+}
+
+func TestSchedulerRecurringWithScheduleFileDB(t *testing.T) {
+	p := NewWorkerPool(1, 8)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	var encoded atomic.Int32
+	db, err := NewScheduleFileDB(filepath.Join(t.TempDir(), "schedules.log"), testCountingJobCodec{encoded: &encoded})
+	if err != nil {
+		t.Fatalf("NewScheduleFileDB returned unexpected error: %v", err)
+	}
+	defer db.Close()
+
+	s := NewScheduler(p, db, time.Millisecond)
+	defer s.Stop()
+	s.Dispatch()
+
+	var dispatched atomic.Int32
+	factory := func() Job {
+		dispatched.Add(1)
+		return TaskBuilder("periodic", NewTaskFunc(context.Background(), "args", testTaskFn)).Build()
+	}
+	if err := s.ScheduleRecurring("periodic", Every(time.Millisecond), factory); err != nil {
+		t.Fatalf("ScheduleRecurring returned unexpected error: %v", err)
+	}
+
+	// the schedules handed out are read while the scheduler re-arms them
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		schedules, _ := db.List()
+		for _, schedule := range schedules {
+			_ = schedule.RunAt
+		}
+	}
+
+	if n := dispatched.Load(); n < 3 {
+		t.Errorf("recurring schedule was not re-armed: dispatched %v times", n)
+	}
+	// re-armed schedules reuse the job encoded when they were first stored
+	if n := encoded.Load(); n != 1 {
+		t.Errorf("unexpected number of encoded jobs: got %v want %v", n, 1)
+	}
+}
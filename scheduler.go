@@ -1,42 +1,114 @@
 package iocast
 
 import (
+	"container/heap"
+	"context"
 	"errors"
 	"log"
+	"sort"
 	"sync"
 	"time"
 )
 
+const (
+	// minScheduleRetryDelay bounds how often the scheduler retries the schedules that could not be enqueued in timer mode.
+	minScheduleRetryDelay = 100 * time.Millisecond
+)
+
 var (
 	ErrScheduledRunInThePast = errors.New("cannot schedule run in the past: when < now")
+	ErrInvalidRecurrence     = errors.New("recurrence has no future occurrences")
 )
 
-type ScheduleDB struct {
-	db *sync.Map
+// ScheduleStore represents a storage for schedules.
+type ScheduleStore interface {
+	Store(id string, s *Schedule) error
+	Delete(id string) error
+	FetchDue(now time.Time) ([]*Schedule, error)
+	List() ([]*Schedule, error)
+}
+
+// timedScheduleStore is implemented by stores that know their earliest run time,
+// which lets the scheduler sleep until it instead of polling.
+type timedScheduleStore interface {
+	ScheduleStore
+	NextRunAt() (time.Time, bool)
+}
+
+// ScheduleMemDB is an in-memory schedule store that keeps its schedules in a min-heap ordered by run time.
+type ScheduleMemDB struct {
+	mu    sync.Mutex
+	heap  scheduleHeap
+	index map[string]*scheduleItem
 }
 
+// NewScheduleMemDB creates and returns a new in-memory schedule store.
+func NewScheduleMemDB() ScheduleStore {
+	return &ScheduleMemDB{
+		index: make(map[string]*scheduleItem),
+	}
+}
+
+// JobFactory creates a fresh job for every occurrence of a recurring schedule.
+type JobFactory func() Job
+
 // Schedule is a task's schedule.
 type Schedule struct {
-	job   Job
-	RunAt time.Time
+	ID         string
+	RunAt      time.Time
+	Recurrence Recurrence
+	job        Job
+	factory    JobFactory
+	// origin is the schedule that was stored in the first place if this one is a copy of it.
+	origin *Schedule
+}
+
+// clone returns a copy of the schedule, stores hand out copies so that callers never share
+// the schedules they hold.
+func (s *Schedule) clone() *Schedule {
+	c := *s
+	c.origin = s.first()
+	return &c
+}
+
+// first returns the schedule that was stored in the first place, the schedule itself if it is not a copy.
+func (s *Schedule) first() *Schedule {
+	if s.origin != nil {
+		return s.origin
+	}
+	return s
+}
+
+func (s *Schedule) nextJob() Job {
+	if s.factory != nil {
+		return s.factory()
+	}
+	return s.job
 }
 
 type Scheduler struct {
-	db              *ScheduleDB
+	db              ScheduleStore
 	wp              *WorkerPool
 	pollingInterval time.Duration
-	done            chan struct{}
+	wake            chan struct{}
+	ctx             context.Context
+	stop            context.CancelFunc
 }
 
-// NewScheduler creates and returns a new scheduler instance.
-func NewScheduler(wp *WorkerPool, pollingInterval time.Duration) *Scheduler {
+// NewScheduler creates and returns a new scheduler instance. Stores that can report
+// their earliest run time, like the in-memory one, are dispatched with a timer set to
+// that deadline; any other store is polled every pollingInterval. In timer mode the
+// polling interval, of at least 100ms, is used as the delay before retrying schedules
+// that could not be enqueued.
+func NewScheduler(wp *WorkerPool, db ScheduleStore, pollingInterval time.Duration) *Scheduler {
+	ctx, stop := context.WithCancel(context.Background())
 	return &Scheduler{
-		db: &ScheduleDB{
-			db: &sync.Map{},
-		},
+		db:              db,
 		wp:              wp,
 		pollingInterval: pollingInterval,
-		done:            make(chan struct{}),
+		wake:            make(chan struct{}, 1),
+		ctx:             ctx,
+		stop:            stop,
 	}
 }
 
@@ -46,14 +118,48 @@ func (s *Scheduler) Schedule(j Job, runAt time.Time) error {
 		return err
 	}
 	schedule := &Schedule{
+		ID:    j.ID(),
 		job:   j,
 		RunAt: runAt,
 	}
-	return s.db.Store(j.ID(), schedule)
+	return s.store(j.ID(), schedule)
+}
+
+// ScheduleRecurring schedules the jobs created by the factory to run on every occurrence of the recurrence.
+func (s *Scheduler) ScheduleRecurring(id string, r Recurrence, factory JobFactory) error {
+	now := time.Now()
+	runAt := r.Next(now)
+	if !runAt.After(now) {
+		return ErrInvalidRecurrence
+	}
+	schedule := &Schedule{
+		ID:         id,
+		RunAt:      runAt,
+		Recurrence: r,
+		factory:    factory,
+	}
+	return s.store(id, schedule)
+}
+
+func (s *Scheduler) store(id string, schedule *Schedule) error {
+	if err := s.db.Store(id, schedule); err != nil {
+		return err
+	}
+	// Let the dispatcher know it may have to wake up earlier.
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
 }
 
-// Dispatch polls the databases for any due schedules and enqueues their tasks for execution.
+// Dispatch watches the database for any due schedules and enqueues their tasks for execution.
 func (s *Scheduler) Dispatch() {
+	if db, ok := s.db.(timedScheduleStore); ok {
+		go s.dispatchOnTimer(db)
+		return
+	}
+
 	ticker := time.NewTicker(s.pollingInterval)
 
 	go func() {
@@ -61,7 +167,7 @@ func (s *Scheduler) Dispatch() {
 			select {
 			case <-ticker.C:
 				s.dispatchDueTasks()
-			case <-s.done:
+			case <-s.ctx.Done():
 				ticker.Stop()
 				return
 			}
@@ -69,30 +175,86 @@ func (s *Scheduler) Dispatch() {
 	}()
 }
 
-func (s *Scheduler) dispatchDueTasks() {
-	schedules, err := s.db.FetchDue(time.Now())
+func (s *Scheduler) dispatchOnTimer(db timedScheduleStore) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		failed := false
+		select {
+		case <-timer.C:
+			failed = s.dispatchDueTasks()
+		case <-s.wake:
+		case <-s.ctx.Done():
+			return
+		}
+
+		timer.Stop()
+		next, ok := db.NextRunAt()
+		if !ok {
+			continue
+		}
+		wait := time.Until(next)
+		if failed {
+			// The earliest schedule may still be due, don't retry it right away.
+			wait = max(wait, s.pollingInterval, minScheduleRetryDelay)
+		}
+		timer.Reset(wait)
+	}
+}
+
+// dispatchDueTasks enqueues the jobs of the due schedules and reports whether any of them
+// could not be enqueued.
+func (s *Scheduler) dispatchDueTasks() bool {
+	now := time.Now()
+	schedules, err := s.db.FetchDue(now)
 	if err != nil {
 		log.Printf("failed to fetch due schedules: %v", err)
-		return
+		return true
 	}
 
+	failed := false
 	for _, schedule := range schedules {
-		ok := s.wp.Enqueue(schedule.job)
-		if !ok {
-			log.Printf("failed to enqueue task with id: %s", schedule.job.ID())
-			return
+		j := schedule.nextJob()
+		if j == nil {
+			log.Printf("schedule %s did not produce a job", schedule.ID)
+		} else if err := s.wp.EnqueueWait(s.ctx, j); err != nil {
+			// The schedule is kept so that it is dispatched again.
+			log.Printf("failed to enqueue task with id %s: %v", j.ID(), err)
+			if errors.Is(err, ErrQueueFull) {
+				// The scheduler is stopping.
+				return true
+			}
+			// Other errors, e.g. a stopped pool or a job naming an unknown queue, must not
+			// hold back the later schedules.
+			failed = true
+			continue
 		}
-		err = s.db.Delete(schedule.job.ID())
+		if schedule.Recurrence != nil {
+			// Re-arm a copy from now on, skipping any occurrences missed while the scheduler
+			// was behind. The store may still hand out the schedule it holds.
+			rearmed := schedule.clone()
+			rearmed.RunAt = schedule.Recurrence.Next(now)
+			if rearmed.RunAt.After(now) {
+				err = s.db.Store(schedule.ID, rearmed)
+				if err != nil {
+					log.Printf("failed to re-arm recurring schedule: %v", err)
+				}
+				continue
+			}
+		}
+		err = s.db.Delete(schedule.ID)
 		if err != nil {
 			log.Printf("failed to delete due schedule: %v", err)
-			return
+			return true
 		}
 	}
+	return failed
 }
 
 // Stop stops the scheduler.
 func (s *Scheduler) Stop() {
-	close(s.done)
+	s.stop()
 }
 
 func (s *Scheduler) validate(runAt time.Time) error {
@@ -103,36 +265,119 @@ func (s *Scheduler) validate(runAt time.Time) error {
 }
 
 // Store stores the schedule in the database.
-func (m *ScheduleDB) Store(id string, s *Schedule) error {
-	m.db.Store(id, s)
+func (m *ScheduleMemDB) Store(id string, s *Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if item, ok := m.index[id]; ok {
+		item.schedule = s
+		item.runAt = s.RunAt
+		heap.Fix(&m.heap, item.pos)
+		return nil
+	}
+	item := &scheduleItem{schedule: s, runAt: s.RunAt}
+	heap.Push(&m.heap, item)
+	m.index[id] = item
 	return nil
 }
 
 // Delete removes a schedule from the database.
-func (m *ScheduleDB) Delete(id string) error {
-	m.db.Delete(id)
+func (m *ScheduleMemDB) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.index[id]
+	if !ok {
+		return nil
+	}
+	heap.Remove(&m.heap, item.pos)
+	delete(m.index, id)
 	return nil
 }
 
-// FetchDue fetches the due schedules from the database.
-func (m *ScheduleDB) FetchDue(now time.Time) ([]*Schedule, error) {
-	var dueSchedules []*Schedule
-	m.db.Range(func(_, value any) bool {
-		schedule, ok := value.(*Schedule)
-		if !ok {
-			return true // skip
-		}
-
-		runTime := time.Date(
-			now.Year(), now.Month(), now.Day(),
-			schedule.RunAt.Hour(), schedule.RunAt.Minute(),
-			schedule.RunAt.Second(), 0, now.Location(),
-		)
+// FetchDue fetches the due schedules from the database, earliest first.
+func (m *ScheduleMemDB) FetchDue(now time.Time) ([]*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		if now.After(runTime) {
-			dueSchedules = append(dueSchedules, schedule)
+	// Walk the heap and prune every subtree whose root is not due,
+	// so the cost depends on the number of due schedules only.
+	var due []*scheduleItem
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(m.heap) || m.heap[i].runAt.After(now) {
+			continue
 		}
-		return true
+		due = append(due, m.heap[i])
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].runAt.Before(due[j].runAt)
 	})
+
+	dueSchedules := make([]*Schedule, len(due))
+	for i, item := range due {
+		dueSchedules[i] = item.schedule.clone()
+	}
 	return dueSchedules, nil
 }
+
+// List returns all the schedules in the database.
+func (m *ScheduleMemDB) List() ([]*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules := make([]*Schedule, len(m.heap))
+	for i, item := range m.heap {
+		schedules[i] = item.schedule.clone()
+	}
+	return schedules, nil
+}
+
+// NextRunAt returns the run time of the earliest schedule in the database.
+func (m *ScheduleMemDB) NextRunAt() (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.heap) == 0 {
+		return time.Time{}, false
+	}
+	return m.heap[0].runAt, true
+}
+
+type scheduleItem struct {
+	schedule *Schedule
+	// runAt is a copy of the schedule's run time at the time it was stored, so that
+	// the heap invariant does not depend on callers leaving the schedule untouched.
+	runAt time.Time
+	pos   int
+}
+
+// scheduleHeap is a min-heap of schedules ordered by their run time.
+type scheduleHeap []*scheduleItem
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].runAt.Before(h[j].runAt) }
+
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *scheduleHeap) Push(x any) {
+	item := x.(*scheduleItem)
+	item.pos = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *scheduleHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
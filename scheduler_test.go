@@ -3,6 +3,8 @@ package iocast
 import (
 	"context"
 	"log"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -16,7 +18,7 @@ func TestScheduler(t *testing.T) {
 
 	task := TaskBuilder("uuid", taskFn).Build()
 
-	s := NewScheduler(p, 50*time.Millisecond)
+	s := NewScheduler(p, NewScheduleMemDB(), 50*time.Millisecond)
 	defer s.Stop()
 
 	s.Dispatch()
@@ -32,3 +34,210 @@ func TestScheduler(t *testing.T) {
 		t.Errorf("wrong result output: got %v want %v", result.Out, expected)
 	}
 }
+
+func TestSchedulerRecurring(t *testing.T) {
+	p := NewWorkerPool(4, 8)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	s := NewScheduler(p, NewScheduleMemDB(), 10*time.Millisecond)
+	defer s.Stop()
+
+	s.Dispatch()
+
+	tasks := make(chan *Task[string], 8)
+	factory := func() Job {
+		taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+		task := TaskBuilder("periodic", taskFn).Build()
+		tasks <- task
+		return task
+	}
+
+	err := s.ScheduleRecurring("periodic", Every(30*time.Millisecond), factory)
+	if err != nil {
+		t.Fatalf("ScheduleRecurring returned unexpected error: %v", err)
+	}
+
+	for range 3 {
+		select {
+		case task := <-tasks:
+			result := <-task.Wait()
+			if result.Out != "args" {
+				t.Errorf("wrong result output: got %v want %v", result.Out, "args")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("recurring schedule was not dispatched")
+		}
+	}
+}
+
+func TestSchedulerFullQueue(t *testing.T) {
+	p := NewWorkerPool(1, 0)
+	defer p.Stop()
+
+	s := NewScheduler(p, NewScheduleMemDB(), 10*time.Millisecond)
+	defer s.Stop()
+	s.Dispatch()
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	tasks := []*Task[string]{
+		TaskBuilder("first", taskFn).Build(),
+		TaskBuilder("second", taskFn).Build(),
+	}
+	for _, task := range tasks {
+		if err := s.Schedule(task, time.Now().Add(10*time.Millisecond)); err != nil {
+			t.Fatalf("Schedule returned unexpected error: %v", err)
+		}
+	}
+
+	// the due tasks wait for the queue to have room instead of being dropped
+	time.Sleep(50 * time.Millisecond)
+	p.Start(context.Background())
+
+	for _, task := range tasks {
+		select {
+		case result := <-task.Wait():
+			if result.Out != "args" {
+				t.Errorf("wrong result output: got %v want %v", result.Out, "args")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("task %s was not dispatched", task.ID())
+		}
+	}
+}
+
+func TestSchedulerRecurringInvalid(t *testing.T) {
+	s := NewScheduler(NewWorkerPool(1, 1), NewScheduleMemDB(), time.Second)
+
+	err := s.ScheduleRecurring("never", Every(0), func() Job { return nil })
+	if err != ErrInvalidRecurrence {
+		t.Errorf("ScheduleRecurring returned unexpected error: got %v want %v", err, ErrInvalidRecurrence)
+	}
+}
+
+func TestSchedulerDispatchesOnTimer(t *testing.T) {
+	p := NewWorkerPool(1, 1)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	// The polling interval is way longer than the schedule, dispatching must not depend on it.
+	s := NewScheduler(p, NewScheduleMemDB(), time.Hour)
+	defer s.Stop()
+
+	s.Dispatch()
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	task := TaskBuilder("uuid", taskFn).Build()
+
+	runAt := time.Now().Add(30 * time.Millisecond)
+	err := s.Schedule(task, runAt)
+	if err != nil {
+		t.Fatalf("Schedule returned unexpected error: %v", err)
+	}
+
+	select {
+	case <-task.Wait():
+		if time.Now().Before(runAt) {
+			t.Errorf("task was dispatched before its run time")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task was not dispatched on time")
+	}
+}
+
+func TestSchedulerEnqueueError(t *testing.T) {
+	r := NewRouter(RoundRobin)
+	r.AddQueue(DefaultQueue, QueueOptions{Capacity: 4})
+	p := NewWorkerPoolWithQueue(1, r)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	// No polling interval, retrying the schedule that cannot be enqueued must not spin.
+	db := NewScheduleMemDB()
+	s := NewScheduler(p, db, 0)
+	defer s.Stop()
+	s.Dispatch()
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	var attempts atomic.Int32
+	factory := func() Job {
+		attempts.Add(1)
+		return TaskBuilder("unknown", taskFn).Queue("reports").Build()
+	}
+	if err := s.ScheduleRecurring("unknown", Every(10*time.Millisecond), factory); err != nil {
+		t.Fatalf("ScheduleRecurring returned unexpected error: %v", err)
+	}
+	task := TaskBuilder("later", taskFn).Build()
+	if err := s.Schedule(task, time.Now().Add(20*time.Millisecond)); err != nil {
+		t.Fatalf("Schedule returned unexpected error: %v", err)
+	}
+
+	// the schedule that cannot be enqueued does not hold back the later ones
+	select {
+	case result := <-task.Wait():
+		if result.Out != "args" {
+			t.Errorf("wrong result output: got %v want %v", result.Out, "args")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("later schedule was not dispatched")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if n := attempts.Load(); n > 5 {
+		t.Errorf("schedule that cannot be enqueued was retried too often: %v times", n)
+	}
+	schedules, _ := db.List()
+	if len(schedules) != 1 || schedules[0].ID != "unknown" {
+		t.Errorf("schedule that cannot be enqueued was not kept: got %v", schedules)
+	}
+}
+
+func TestScheduleMemDB(t *testing.T) {
+	db := NewScheduleMemDB().(*ScheduleMemDB)
+
+	now := time.Now()
+	offsets := []int{5, 3, 9, 1, 7, 2, 8}
+	for _, offset := range offsets {
+		id := strconv.Itoa(offset)
+		err := db.Store(id, &Schedule{ID: id, RunAt: now.Add(time.Duration(offset) * time.Second)})
+		if err != nil {
+			t.Fatalf("Store returned unexpected error: %v", err)
+		}
+	}
+
+	next, ok := db.NextRunAt()
+	if !ok || !next.Equal(now.Add(time.Second)) {
+		t.Errorf("NextRunAt returned unexpected time: got %v want %v", next, now.Add(time.Second))
+	}
+
+	due, err := db.FetchDue(now.Add(5 * time.Second))
+	if err != nil {
+		t.Fatalf("FetchDue returned unexpected error: %v", err)
+	}
+	expected := []string{"1", "2", "3", "5"}
+	if len(due) != len(expected) {
+		t.Fatalf("FetchDue returned unexpected number of schedules: got %v want %v", len(due), len(expected))
+	}
+	for i, s := range due {
+		if s.ID != expected[i] {
+			t.Errorf("FetchDue returned schedules out of order: got %v want %v", s.ID, expected[i])
+		}
+	}
+
+	if err := db.Delete("1"); err != nil {
+		t.Fatalf("Delete returned unexpected error: %v", err)
+	}
+	rearmed := &Schedule{ID: "2", RunAt: now.Add(10 * time.Second)}
+	if err := db.Store("2", rearmed); err != nil {
+		t.Fatalf("Store returned unexpected error: %v", err)
+	}
+
+	next, _ = db.NextRunAt()
+	if !next.Equal(now.Add(3 * time.Second)) {
+		t.Errorf("NextRunAt returned unexpected time: got %v want %v", next, now.Add(3*time.Second))
+	}
+	schedules, _ := db.List()
+	if len(schedules) != len(offsets)-1 {
+		t.Errorf("List returned unexpected number of schedules: got %v want %v", len(schedules), len(offsets)-1)
+	}
+}
@@ -2,7 +2,10 @@ package iocast
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
+	"slices"
 	"sync"
 	"time"
 )
@@ -16,25 +19,89 @@ type taskStatus string
 func (taskStatus) status() {}
 
 var (
-	TaskStatusPending = taskStatus("PENDING")
-	TaskStatusRunning = taskStatus("RUNNING")
-	TaskStatusFailed  = taskStatus("FAILED")
-	TaskStatusSuccess = taskStatus("SUCCESS")
+	TaskStatusPending   = taskStatus("PENDING")
+	TaskStatusRunning   = taskStatus("RUNNING")
+	TaskStatusFailed    = taskStatus("FAILED")
+	TaskStatusSuccess   = taskStatus("SUCCESS")
+	TaskStatusTimedOut  = taskStatus("TIMED_OUT")
+	TaskStatusCancelled = taskStatus("CANCELLED")
+)
+
+var (
+	ErrTaskTimedOut  = errors.New("task timed out")
+	ErrTaskCancelled = errors.New("task cancelled")
 )
 
 // Job represents a task to be executed.
 type Job interface {
 	ID() string
 	Exec(context.Context)
+	Cancel()
 	Write() error
 	Metadata() Metadata
 }
 
 type Metadata struct {
-	CreatetAt time.Time     `json:"created_at"`
+	CreatetAt  time.Time     `json:"created_at"`
+	EnqueuedAt time.Time     `json:"enqueued_at,omitempty"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at,omitempty"`
+	Elapsed    time.Duration `json:"elapsed"`
+	QueueWait  time.Duration `json:"queue_wait,omitempty"`
+	WorkerID   int           `json:"worker_id,omitempty"`
+	Status     status        `json:"status"`
+	Attempts   []Attempt     `json:"attempts,omitempty"`
+	Tags       []string      `json:"tags,omitempty"`
+	Priority   int           `json:"priority,omitempty"`
+	Queue      string        `json:"queue,omitempty"`
+	Timeout    time.Duration `json:"timeout,omitempty"`
+	Deadline   time.Time     `json:"deadline,omitempty"`
+	Panic      string        `json:"panic,omitempty"`
+	PanicStack string        `json:"panic_stack,omitempty"`
+}
+
+// clone returns a copy of the metadata that does not share the attempts with the original.
+func (m Metadata) clone() Metadata {
+	m.Attempts = slices.Clone(m.Attempts)
+	return m
+}
+
+// Attempt records a single attempt of a task.
+type Attempt struct {
+	Number int `json:"number"`
+	// Step is the position of the task in its pipeline, starting from 1, or zero for a standalone task.
+	Step      int           `json:"step,omitempty"`
 	StartedAt time.Time     `json:"started_at"`
 	Elapsed   time.Duration `json:"elapsed"`
-	Status    status        `json:"status"`
+	Err       string        `json:"err,omitempty"`
+}
+
+// enqueuer is implemented by the jobs that record when they are enqueued.
+type enqueuer interface {
+	markEnqueued(time.Time)
+}
+
+// routed is implemented by the jobs that name the router queue they are enqueued to.
+type routed interface {
+	queueName() string
+}
+
+// retryDefaulter is implemented by the jobs that accept the retry defaults of a router queue.
+type retryDefaulter interface {
+	applyRetryDefaults(maxRetries int, policy RetryPolicy)
+}
+
+// prioritized is implemented by the jobs that have a priority.
+type prioritized interface {
+	priority() int
+}
+
+// jobPriority returns the priority of the job, zero if it has none.
+func jobPriority(j Job) int {
+	if p, ok := j.(prioritized); ok {
+		return p.priority()
+	}
+	return 0
 }
 
 // Result is the output of a task's execution.
@@ -42,28 +109,52 @@ type Result[T any] struct {
 	Out      T        `json:"out"`
 	Err      error    `json:"err"`
 	Metadata Metadata `json:"metadata"`
+	// retryable is whether the task that failed judged Err worth retrying, nil if unknown.
+	retryable *bool
+}
+
+// untyped returns the result with its output as any.
+func (r Result[T]) untyped() Result[any] {
+	return Result[any]{Out: r.Out, Err: r.Err, Metadata: r.Metadata, retryable: r.retryable}
 }
 
-type TaskFn[T any] func(previousResult Result[T]) Result[T]
+// TaskFn is the function run on every attempt of a task. The context is the attempt's own,
+// derived from the context the task is executed with and bound by the task's timeout and deadline.
+type TaskFn[T any] func(ctx context.Context, previousResult Result[T]) Result[T]
 
 type Task[T any] struct {
-	mu         sync.RWMutex
-	id         string
-	taskFn     TaskFn[T]
-	resultChan chan Result[T]
-	next       *Task[T]
-	maxRetries int
-	backoff    []time.Duration
-	db         DB
-	metadata   Metadata
-}
-
-// NewTaskFunc initializes and returns a new task func.
+	mu          sync.RWMutex
+	id          string
+	taskFn      TaskFn[T]
+	result      *future[T]
+	next        *Task[T]
+	maxRetries  int
+	retryPolicy RetryPolicy
+	retryIf     func(error) bool
+	permPanics  bool
+	retriesSet  bool
+	policySet   bool
+	timeout     time.Duration
+	deadline    time.Time
+	db          DB
+	metadata    Metadata
+	envelope    *TaskEnvelope
+	hooks       taskHooks[T]
+	middleware  []Middleware
+	cancel      context.CancelCauseFunc
+	cancelled   bool
+	finished    bool
+}
+
+// NewTaskFunc initializes and returns a new task func. The context passed to fn is
+// cancelled when either the given context or the execution context of the attempt is.
 func NewTaskFunc[Arg, T any](
 	ctx context.Context,
 	args Arg,
 	fn func(ctx context.Context, args Arg) (T, error)) TaskFn[T] {
-	return func(_ Result[T]) Result[T] {
+	return func(attemptCtx context.Context, _ Result[T]) Result[T] {
+		ctx, cancel := mergeContexts(ctx, attemptCtx)
+		defer cancel()
 		out, err := fn(ctx, args)
 		return Result[T]{Out: out, Err: err}
 	}
@@ -74,7 +165,9 @@ func NewTaskFuncWithPreviousResult[Arg, T any](
 	ctx context.Context,
 	args Arg,
 	fn func(ctx context.Context, args Arg, previousResult Result[T]) (T, error)) TaskFn[T] {
-	return func(previous Result[T]) Result[T] {
+	return func(attemptCtx context.Context, previous Result[T]) Result[T] {
+		ctx, cancel := mergeContexts(ctx, attemptCtx)
+		defer cancel()
 		out, err := fn(ctx, args, previous)
 		return Result[T]{Out: out, Err: err}
 	}
@@ -84,6 +177,50 @@ func (t *Task[T]) link(next *Task[T]) {
 	t.next = next
 }
 
+func (t *Task[T]) markEnqueued(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metadata.EnqueuedAt = now.UTC()
+}
+
+func (t *Task[T]) queueName() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.metadata.Queue
+}
+
+// applyRetryDefaults sets the retries and the retry policy of the tasks in the chain that were built without them.
+func (t *Task[T]) applyRetryDefaults(maxRetries int, policy RetryPolicy) {
+	for task := t; task != nil; task = task.next {
+		task.mu.Lock()
+		if !task.retriesSet && maxRetries > 0 {
+			task.maxRetries = maxRetries
+		}
+		if !task.policySet && policy != nil {
+			task.retryPolicy = policy
+		}
+		task.mu.Unlock()
+	}
+}
+
+func (t *Task[T]) priority() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.metadata.Priority
+}
+
+// markDequeued records the worker executing the task and how long the task waited for it.
+func (t *Task[T]) markDequeued(env *execEnv) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if env != nil {
+		t.metadata.WorkerID = env.workerID
+	}
+	if !t.metadata.EnqueuedAt.IsZero() {
+		t.metadata.QueueWait = time.Since(t.metadata.EnqueuedAt)
+	}
+}
+
 func (t *Task[T]) markRunning() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -91,11 +228,54 @@ func (t *Task[T]) markRunning() {
 	t.metadata.Status = TaskStatusRunning
 }
 
-func (t *Task[T]) markFailed() {
+func (t *Task[T]) markFailed(err error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.metadata.Elapsed = time.Since(t.metadata.StartedAt)
-	t.metadata.Status = TaskStatusFailed
+	switch {
+	case errors.Is(err, ErrTaskCancelled):
+		t.metadata.Status = TaskStatusCancelled
+	case errors.Is(err, ErrTaskTimedOut):
+		t.metadata.Status = TaskStatusTimedOut
+	default:
+		t.metadata.Status = TaskStatusFailed
+	}
+}
+
+func (t *Task[T]) markAttempt(a Attempt) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metadata.Attempts = append(t.metadata.Attempts, a)
+}
+
+// markStep records the attempts of the given pipeline step on the head of the pipeline.
+func (t *Task[T]) markStep(step *Task[T], idx int) {
+	attempts := step.Metadata().Attempts
+	for i := range attempts {
+		attempts[i].Step = idx
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if step == t {
+		t.metadata.Attempts = attempts
+		return
+	}
+	t.metadata.Attempts = append(t.metadata.Attempts, attempts...)
+}
+
+func (t *Task[T]) markPanicked(err *PanicError) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metadata.Panic = fmt.Sprint(err.Value)
+	t.metadata.PanicStack = string(err.Stack)
+}
+
+func (t *Task[T]) isRetryable(err error) bool {
+	var panicErr *PanicError
+	if t.permPanics && errors.As(err, &panicErr) {
+		return false
+	}
+	return isRetryable(err, t.retryIf)
 }
 
 func (t *Task[T]) markSuccess() {
@@ -109,37 +289,173 @@ func (t *Task[T]) try(ctx context.Context, previous Result[T]) Result[T] {
 	var result Result[T]
 
 	t.markRunning()
+	t.started()
+	start := time.Now()
 
-	result = t.taskFn(previous)
-	if result.Err == nil {
-		t.markSuccess()
-		return result
+	taskCtx := ctx
+	if !t.deadline.IsZero() {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithDeadline(taskCtx, t.deadline)
+		defer cancel()
 	}
 
-RETRY:
-	for i := range t.maxRetries {
-		var backoff time.Duration = 0
-		if len(t.backoff) > 0 {
-			backoff = t.backoff[i]
+	var delay time.Duration
+	var exited <-chan struct{}
+	for attempt := 1; ; attempt++ {
+		result, exited = t.attempt(taskCtx, attempt, previous)
+		if result.Err == nil {
+			t.markSuccess()
+			return result
+		}
+		// The stored result keeps whether the task judged its error worth retrying.
+		retryable := t.isRetryable(result.Err)
+		result.retryable = &retryable
+		if taskCtx.Err() != nil || attempt > t.maxRetries || !retryable {
+			return result
+		}
+
+		var ok bool
+		delay, ok = t.retryPolicy.Next(RetryState{
+			Attempt:   attempt,
+			Err:       result.Err,
+			Elapsed:   time.Since(start),
+			LastDelay: delay,
+		})
+		if !ok {
+			return result
+		}
+		var retryAfter *RetryAfterError
+		if errors.As(result.Err, &retryAfter) {
+			delay = retryAfter.Delay
 		}
+		t.retrying(execEnvFrom(ctx), attempt, result.Err)
+
+		timer := time.NewTimer(delay)
 		select {
-		case <-time.After(backoff):
-			result = t.taskFn(previous)
-			if result.Err == nil {
-				t.markSuccess()
-				break RETRY
-			}
-		case <-ctx.Done():
+		case <-timer.C:
+		case <-taskCtx.Done():
+			timer.Stop()
 			// At least the first attempt has failed so result does exist
-			break RETRY
+			result.Err = interrupted(taskCtx, result.Err)
+			return result
+		}
+		// An attempt given up on at its timeout may still be running, don't run
+		// another copy of the task func alongside it.
+		select {
+		case <-exited:
+		case <-taskCtx.Done():
+			result.Err = interrupted(taskCtx, result.Err)
+			return result
+		}
+	}
+}
+
+// attempt runs the task func once through the middleware chain, giving up on it
+// when its timeout or the task's deadline expires. The returned channel is closed
+// once the task func has returned, which may be after an attempt given up on.
+func (t *Task[T]) attempt(taskCtx context.Context, attempt int, previous Result[T]) (Result[T], <-chan struct{}) {
+	ctx := taskCtx
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	info := AttemptInfo{
+		TaskID:   t.id,
+		Attempt:  attempt,
+		Metadata: t.Metadata(),
+	}
+	middleware := t.middleware
+	if env := execEnvFrom(ctx); env != nil {
+		// the pool's middleware wraps the task's own
+		middleware = append(env.middleware[:len(env.middleware):len(env.middleware)], middleware...)
+	}
+
+	startedAt := time.Now()
+	done := make(chan Result[T], 1)
+	exited := make(chan struct{})
+	// panicErr is only read once the result is received, an attempt given up on
+	// must not touch the task's metadata.
+	var panicErr *PanicError
+	go func() {
+		defer close(exited)
+		var result Result[T]
+		defer func() {
+			if r := recover(); r != nil {
+				panicErr = &PanicError{Value: r, Stack: debug.Stack()}
+				done <- Result[T]{Err: panicErr}
+			}
+		}()
+		h := chain(func(ctx context.Context, _ AttemptInfo) error {
+			result = t.taskFn(ctx, previous)
+			return result.Err
+		}, middleware)
+		result.Err = h(ctx, info)
+		done <- result
+	}()
+
+	var result Result[T]
+	received := true
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		// Prefer the result if the task func returned right as the context expired.
+		select {
+		case result = <-done:
+		default:
+			received = false
+			result.Err = ctx.Err()
 		}
 	}
-	return result
+	if received && panicErr != nil {
+		t.markPanicked(panicErr)
+	}
+	if result.Err != nil {
+		result.Err = interrupted(ctx, result.Err)
+	}
+
+	a := Attempt{
+		Number:    attempt,
+		StartedAt: startedAt.UTC(),
+		Elapsed:   time.Since(startedAt),
+	}
+	if result.Err != nil {
+		a.Err = result.Err.Error()
+	}
+	t.markAttempt(a)
+	return result, exited
+}
+
+// interrupted marks the error of an attempt that failed because it was
+// cancelled, cut short by the pool stopping or ran out of time, judging by the attempt's context.
+func interrupted(ctx context.Context, err error) error {
+	var reason error
+	switch {
+	case errors.Is(context.Cause(ctx), ErrTaskCancelled):
+		reason = ErrTaskCancelled
+	case errors.Is(context.Cause(ctx), ErrPoolStopped):
+		reason = ErrPoolStopped
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		reason = ErrTaskTimedOut
+	}
+	if reason == nil || errors.Is(err, reason) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", reason, err)
 }
 
-// Wait blocks on the result channel of the task until it is ready.
+// Wait returns a channel that receives the result of the task when it is ready.
+// It can be called any number of times, before or after the result is ready, but
+// every call before then holds on to a new channel until the result is delivered.
+// Callers that poll the task should select on Done and call Wait once it is closed.
 func (t *Task[T]) Wait() <-chan Result[T] {
-	return t.resultChan
+	return t.result.subscribe()
+}
+
+// Done returns a channel that is closed when the result of the task is ready.
+func (t *Task[T]) Done() <-chan struct{} {
+	return t.result.done
 }
 
 // ID is an ID geter.
@@ -147,58 +463,147 @@ func (t *Task[T]) ID() string {
 	return t.id
 }
 
-// Wait blocks on the result channel if there's a writer and writes the result when ready.
+// Write waits for the result if there's a writer and writes the result when ready.
 func (t *Task[T]) Write() error {
 	if t.db != nil {
-		result, ok := <-t.resultChan
-		if !ok {
-			return nil
-		}
-		return t.db.Write(t.id, Result[any]{
-			Out:      result.Out,
-			Err:      result.Err,
-			Metadata: result.Metadata,
-		})
+		result := t.result.wait()
+		return t.db.Write(t.id, result.untyped())
 	}
 	return nil
 }
 
 // Exec executes the task.
 func (t *Task[T]) Exec(ctx context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	env := execEnvFrom(ctx)
+	if !t.start(cancel) {
+		// cancelled while pending, the result has already been delivered
+		result := t.result.wait()
+		jobCompleted(env, result.untyped())
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			// A panic outside the task func, e.g. in a RetryIf predicate or a retry policy.
+			if t.isFinished() {
+				// the result has been delivered already, let the worker recover
+				panic(r)
+			}
+			panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+			t.markPanicked(panicErr)
+			t.markFailed(panicErr)
+			// The retry predicate or policy itself panicked, the error is not worth retrying.
+			retryable := false
+			t.finish(env, Result[T]{Err: panicErr, retryable: &retryable})
+		}
+	}()
+	t.markDequeued(env)
+	jobStarted(env)
+
 	idx := 1
 	var result Result[T]
 
 	result = t.try(ctx, result)
+	if t.next != nil {
+		t.markStep(t, idx)
+	}
 	if result.Err != nil {
 		// it's a pipeline so wrap the error
 		if t.next != nil {
-			result.Err = fmt.Errorf("error in task number %d: %w", idx, result.Err)
+			result.Err = &StepError{Step: idx, Err: result.Err}
 		}
-		t.markFailed()
-		t.resultChan <- result
-		close(t.resultChan)
+		t.markFailed(result.Err)
+		t.finish(env, result)
 		return
 	}
 	for t.next != nil {
 		idx++
 
-		result = t.next.try(ctx, result)
+		if ctx.Err() != nil {
+			// stop the pipeline before running the next task
+			result = Result[T]{Err: interrupted(ctx, context.Cause(ctx))}
+		} else {
+			result = t.next.try(ctx, result)
+			t.markStep(t.next, idx)
+		}
 		if result.Err != nil {
-			result.Err = fmt.Errorf("error in task number %d: %w", idx, result.Err)
+			result.Err = &StepError{Step: idx, Err: result.Err}
 			// mark the head of the pipeline
-			t.markFailed()
+			t.markFailed(result.Err)
 			break
 		}
 		t.next = t.next.next
 	}
-	result.Metadata = t.metadata
-	t.resultChan <- result
-	close(t.resultChan)
+	t.finish(env, result)
+}
+
+// Cancel cancels the task. A pending task is not executed at all, while a running
+// one has the context of its attempt cancelled and is not retried. In both cases
+// the result is delivered with ErrTaskCancelled.
+func (t *Task[T]) Cancel() {
+	t.mu.Lock()
+	if t.finished || t.cancelled {
+		t.mu.Unlock()
+		return
+	}
+	t.cancelled = true
+	if t.cancel != nil {
+		t.mu.Unlock()
+		t.cancel(ErrTaskCancelled)
+		return
+	}
+	t.finished = true
+	t.metadata.Status = TaskStatusCancelled
+	t.metadata.FinishedAt = time.Now().UTC()
+	result := Result[T]{Err: ErrTaskCancelled, Metadata: t.metadata.clone()}
+	t.mu.Unlock()
+
+	t.result.resolve(result)
+	t.completed(nil, result)
+}
+
+// start registers the cancel func of the execution, unless the task was cancelled before it started.
+func (t *Task[T]) start(cancel context.CancelCauseFunc) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancelled || t.finished {
+		return false
+	}
+	t.cancel = cancel
+	return true
+}
+
+func (t *Task[T]) isFinished() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.finished
+}
+
+// finish delivers the result of the execution and then runs the completion hooks,
+// so hooks waiting on the result do not block.
+func (t *Task[T]) finish(env *execEnv, result Result[T]) {
+	t.mu.Lock()
+	t.finished = true
+	t.metadata.FinishedAt = time.Now().UTC()
+	result.Metadata = t.metadata.clone()
+	t.mu.Unlock()
+
+	t.result.resolve(result)
+	t.completed(env, result)
+}
+
+// Envelope returns the serializable form of a task created by a registry.
+func (t *Task[T]) Envelope() (TaskEnvelope, error) {
+	if t.envelope == nil {
+		return TaskEnvelope{}, fmt.Errorf("%w: %s", ErrTaskNotSerializable, t.id)
+	}
+	return *t.envelope, nil
 }
 
 // Metadata is a metadata getter.
 func (t *Task[T]) Metadata() Metadata {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	return t.metadata
+	return t.metadata.clone()
 }
@@ -3,7 +3,9 @@ package iocast
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var (
@@ -68,3 +70,293 @@ func TestTask(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskTimeout(t *testing.T) {
+	blocking := func(ctx context.Context, _ string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	var running, overlapping atomic.Int32
+	ignoring := func(_ context.Context, _ string) (string, error) {
+		if running.Add(1) > 1 {
+			overlapping.Store(1)
+		}
+		defer running.Add(-1)
+		time.Sleep(100 * time.Millisecond)
+		return "too late", nil
+	}
+	// the abandoned attempt panics after the task is done
+	panicking := func(_ context.Context, _ string) (string, error) {
+		time.Sleep(100 * time.Millisecond)
+		panic("too late")
+	}
+
+	tests := []struct {
+		name string
+		fn   func(context.Context, string) (string, error)
+	}{
+		{"task func honours the context", blocking},
+		{"task func ignores the context", ignoring},
+		{"task func panics past its timeout", panicking},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskFn := NewTaskFunc(context.Background(), "args", tt.fn)
+			task := TaskBuilder("uuid", taskFn).Timeout(20 * time.Millisecond).Build()
+
+			start := time.Now()
+			task.Exec(context.Background())
+			result := <-task.Wait()
+
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("task was not bounded by its timeout: ran for %v", elapsed)
+			}
+			if !errors.Is(result.Err, ErrTaskTimedOut) || !errors.Is(result.Err, context.DeadlineExceeded) {
+				t.Errorf("unexpected result error: got %v want %v", result.Err, ErrTaskTimedOut)
+			}
+			m := task.Metadata()
+			if m.Status != TaskStatusTimedOut {
+				t.Errorf("unexpected status: got %v want %v", m.Status, TaskStatusTimedOut)
+			}
+			if m.Timeout != 20*time.Millisecond {
+				t.Errorf("unexpected timeout in metadata: got %v want %v", m.Timeout, 20*time.Millisecond)
+			}
+			// the retry waits for the abandoned attempt to return
+			if overlapping.Load() != 0 {
+				t.Error("attempts of the task func ran at once")
+			}
+			time.Sleep(150 * time.Millisecond)
+			if m := task.Metadata(); m.Panic != "" {
+				t.Errorf("abandoned attempt recorded its panic: %v", m.Panic)
+			}
+		})
+	}
+}
+
+func TestTaskDeadline(t *testing.T) {
+	attempts := 0
+	taskFn := NewTaskFunc(context.Background(), "args", func(_ context.Context, _ string) (string, error) {
+		attempts++
+		return "", errors.New("something went wrong")
+	})
+	task := TaskBuilder("uuid", taskFn).
+		MaxRetries(10).
+		BackOff([]time.Duration{30 * time.Millisecond}).
+		Deadline(time.Now().Add(50 * time.Millisecond)).
+		Build()
+
+	task.Exec(context.Background())
+	result := <-task.Wait()
+
+	if attempts != 2 {
+		t.Errorf("unexpected total attempts made: got %v want %v", attempts, 2)
+	}
+	if !errors.Is(result.Err, ErrTaskTimedOut) {
+		t.Errorf("unexpected result error: got %v want %v", result.Err, ErrTaskTimedOut)
+	}
+	if result.Metadata.Status != TaskStatusTimedOut {
+		t.Errorf("unexpected status: got %v want %v", result.Metadata.Status, TaskStatusTimedOut)
+	}
+}
+
+func TestTaskCancel(t *testing.T) {
+	t.Run("pending task", func(t *testing.T) {
+		executed := false
+		taskFn := NewTaskFunc(context.Background(), "args", func(_ context.Context, args string) (string, error) {
+			executed = true
+			return args, nil
+		})
+		task := TaskBuilder("uuid", taskFn).Build()
+
+		task.Cancel()
+		result := <-task.Wait()
+		task.Exec(context.Background())
+
+		if executed {
+			t.Error("cancelled task was executed")
+		}
+		if !errors.Is(result.Err, ErrTaskCancelled) {
+			t.Errorf("unexpected result error: got %v want %v", result.Err, ErrTaskCancelled)
+		}
+		if result.Metadata.Status != TaskStatusCancelled {
+			t.Errorf("unexpected status: got %v want %v", result.Metadata.Status, TaskStatusCancelled)
+		}
+	})
+
+	t.Run("running task", func(t *testing.T) {
+		started := make(chan struct{})
+		taskFn := NewTaskFunc(context.Background(), "args", func(ctx context.Context, _ string) (string, error) {
+			close(started)
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+		task := TaskBuilder("uuid", taskFn).MaxRetries(3).Build()
+
+		go task.Exec(context.Background())
+		<-started
+		task.Cancel()
+
+		result := <-task.Wait()
+		if !errors.Is(result.Err, ErrTaskCancelled) {
+			t.Errorf("unexpected result error: got %v want %v", result.Err, ErrTaskCancelled)
+		}
+		if result.Metadata.Status != TaskStatusCancelled {
+			t.Errorf("unexpected status: got %v want %v", result.Metadata.Status, TaskStatusCancelled)
+		}
+	})
+}
+
+func TestWorkerPoolCancel(t *testing.T) {
+	p := NewWorkerPool(1, 1)
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	task := TaskBuilder("uuid", taskFn).Build()
+	p.Enqueue(task)
+
+	if ok := p.Cancel("unknown"); ok {
+		t.Error("Cancel found an unknown job")
+	}
+	if ok := p.Cancel("uuid"); !ok {
+		t.Error("Cancel did not find the enqueued job")
+	}
+
+	p.Start(context.Background())
+	defer p.Stop()
+
+	result := <-task.Wait()
+	if !errors.Is(result.Err, ErrTaskCancelled) {
+		t.Errorf("unexpected result error: got %v want %v", result.Err, ErrTaskCancelled)
+	}
+}
+
+func TestTaskPanic(t *testing.T) {
+	tests := []struct {
+		name         string
+		permanent    bool
+		recoverAfter int
+		attempts     int
+		status       status
+	}{
+		{"panic is retried", false, 1, 2, TaskStatusSuccess},
+		{"retries are exhausted", false, 3, 2, TaskStatusFailed},
+		{"panic is permanent", true, 1, 1, TaskStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			fn := func(_ context.Context, args string) (string, error) {
+				attempts++
+				if attempts <= tt.recoverAfter {
+					panic("bad payload")
+				}
+				return args, nil
+			}
+			b := TaskBuilder("uuid", NewTaskFunc(context.Background(), "args", fn)).MaxRetries(1)
+			if tt.permanent {
+				b.PermanentPanics()
+			}
+			task := b.Build()
+
+			task.Exec(context.Background())
+			result := <-task.Wait()
+
+			if attempts != tt.attempts {
+				t.Errorf("unexpected attempts: got %v want %v", attempts, tt.attempts)
+			}
+			m := task.Metadata()
+			if m.Status != tt.status {
+				t.Errorf("unexpected status: got %v want %v", m.Status, tt.status)
+			}
+			if m.Panic != "bad payload" || m.PanicStack == "" {
+				t.Errorf("unexpected panic in metadata: got %q want %q", m.Panic, "bad payload")
+			}
+			if tt.status == TaskStatusSuccess {
+				return
+			}
+			var panicErr *PanicError
+			if !errors.As(result.Err, &panicErr) {
+				t.Fatalf("unexpected result error: got %v want a PanicError", result.Err)
+			}
+			if panicErr.Value != "bad payload" || len(panicErr.Stack) == 0 {
+				t.Errorf("unexpected panic error: got %v with %d bytes of stack", panicErr.Value, len(panicErr.Stack))
+			}
+		})
+	}
+}
+
+func TestTaskPanicOutsideAttempt(t *testing.T) {
+	failing := func(_ context.Context, _ string) (string, error) {
+		return "", errors.New("something went wrong")
+	}
+	taskFn := NewTaskFunc(context.Background(), "args", failing)
+
+	tests := []struct {
+		name string
+		task *Task[string]
+	}{
+		{
+			"retry predicate",
+			TaskBuilder("uuid", taskFn).RetryIf(func(error) bool { panic("bad predicate") }).Build(),
+		},
+		{
+			"retry policy",
+			TaskBuilder("uuid", taskFn).RetryPolicy(RetryPolicyFunc(func(RetryState) (time.Duration, bool) {
+				panic("bad policy")
+			})).Build(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.task.Exec(context.Background())
+
+			select {
+			case result := <-tt.task.Wait():
+				var panicErr *PanicError
+				if !errors.As(result.Err, &panicErr) {
+					t.Errorf("unexpected result error: got %v want a PanicError", result.Err)
+				}
+				if result.Metadata.Status != TaskStatusFailed {
+					t.Errorf("unexpected status: got %v want %v", result.Metadata.Status, TaskStatusFailed)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("the result of the task was not delivered")
+			}
+		})
+	}
+}
+
+func TestTaskAttempts(t *testing.T) {
+	failing := func(_ context.Context, _ string) (string, error) {
+		return "", errors.New("something went wrong")
+	}
+	taskFn := NewTaskFunc(context.Background(), "args", failing)
+	task := TaskBuilder("uuid", taskFn).MaxRetries(2).Build()
+
+	task.Exec(context.Background())
+	<-task.Wait()
+
+	m := task.Metadata()
+	if len(m.Attempts) != 3 {
+		t.Fatalf("unexpected number of attempts: got %v want %v", len(m.Attempts), 3)
+	}
+	for i, a := range m.Attempts {
+		if a.Number != i+1 {
+			t.Errorf("unexpected attempt number: got %v want %v", a.Number, i+1)
+		}
+		if a.Err != "something went wrong" {
+			t.Errorf("unexpected attempt error: got %q want %q", a.Err, "something went wrong")
+		}
+		if a.StartedAt.Before(m.StartedAt) {
+			t.Errorf("attempt started at %v before the task did at %v", a.StartedAt, m.StartedAt)
+		}
+	}
+	if m.FinishedAt.Before(m.Attempts[2].StartedAt) {
+		t.Errorf("task finished at %v before its last attempt started at %v", m.FinishedAt, m.Attempts[2].StartedAt)
+	}
+	if !m.EnqueuedAt.IsZero() || m.WorkerID != 0 {
+		t.Errorf("unexpected queue metadata for a task executed directly: %v, worker %v", m.EnqueuedAt, m.WorkerID)
+	}
+}
@@ -2,65 +2,498 @@ package iocast
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"runtime/debug"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	// enqueuePollInterval is how often EnqueueWait retries on queues that cannot tell when they have room.
+	enqueuePollInterval = 10 * time.Millisecond
+)
+
+var (
+	ErrPoolStopped        = errors.New("worker pool is stopped")
+	ErrPoolAlreadyStarted = errors.New("worker pool is already started")
+	ErrInvalidPoolSize    = errors.New("invalid worker pool size")
+)
+
+type poolState string
+
+const (
+	PoolStateCreated  = poolState("CREATED")
+	PoolStateRunning  = poolState("RUNNING")
+	PoolStateDraining = poolState("DRAINING")
+	PoolStateStopped  = poolState("STOPPED")
+)
+
+// releaser is implemented by the queues that can give a popped job back without
+// acknowledging it, so that a durable queue replays it instead of losing it.
+type releaser interface {
+	release(Job) error
+}
+
+// depther is implemented by the queues that can tell how many jobs wait at each priority.
+type depther interface {
+	Depth() map[int]int
+}
+
+// runnableLener is implemented by the queues that hold back some of their waiting jobs,
+// so that the workers cannot take all of them right away.
+type runnableLener interface {
+	runnableLen() int
+}
+
+// spaceNotifier is implemented by the queues that can tell when they may have room for a job.
+type spaceNotifier interface {
+	space() <-chan struct{}
+}
+
 type WorkerPool struct {
-	queue   chan Job
-	workers int
-	wg      *sync.WaitGroup
+	mu         sync.Mutex
+	state      poolState
+	done       chan struct{}
+	cancel     context.CancelCauseFunc
+	discard    atomic.Bool
+	forced     atomic.Bool
+	unfinished []string
+	queue      Queue
+	workers    int
+	ctx        context.Context
+	retirees   []context.CancelFunc
+	lastID     int
+	busy       atomic.Int64
+	waitSum    atomic.Int64
+	waitCount  atomic.Int64
+	wg         *sync.WaitGroup
+	jobs       *sync.Map
+	hooks      *poolHooks
+	middleware *middlewareChain
 }
 
 // NewWorkerPool initializes and returns new workerpool instance.
 func NewWorkerPool(workers, capacity int) *WorkerPool {
+	return NewWorkerPoolWithQueue(workers, NewMemQueue(capacity))
+}
+
+// NewWorkerPoolWithQueue initializes and returns new workerpool instance that pulls its jobs from the given queue.
+func NewWorkerPoolWithQueue(workers int, queue Queue) *WorkerPool {
 	return &WorkerPool{
-		queue:   make(chan Job, capacity),
-		workers: workers,
-		wg:      &sync.WaitGroup{},
+		state:      PoolStateCreated,
+		done:       make(chan struct{}),
+		queue:      queue,
+		workers:    workers,
+		wg:         &sync.WaitGroup{},
+		jobs:       &sync.Map{},
+		hooks:      &poolHooks{},
+		middleware: &middlewareChain{},
 	}
 }
 
-// Enqueue pushes a task to the queue.
-func (p WorkerPool) Enqueue(t Job) bool {
-	select {
-	case p.queue <- t:
-		return true
-	default:
+// State returns the current state of the worker pool.
+func (p *WorkerPool) State() poolState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Done returns a channel that is closed once the worker pool has stopped and its
+// workers have finished their last jobs.
+func (p *WorkerPool) Done() <-chan struct{} {
+	return p.done
+}
+
+// Enqueue pushes a task to the queue without blocking. It returns ErrQueueFull if
+// the queue has no capacity left and ErrPoolStopped if the pool is stopping or stopped.
+func (p *WorkerPool) Enqueue(t Job) error {
+	if state := p.State(); state == PoolStateDraining || state == PoolStateStopped {
+		return ErrPoolStopped
+	}
+	if e, ok := t.(enqueuer); ok {
+		e.markEnqueued(time.Now())
+	}
+	p.jobs.Store(t.ID(), t)
+	err := p.queue.Push(t)
+	if err != nil {
+		p.jobs.CompareAndDelete(t.ID(), t)
+		if errors.Is(err, ErrQueueClosed) {
+			return ErrPoolStopped
+		}
+	}
+	return err
+}
+
+// EnqueueWait pushes a task to the queue, blocking until the queue has capacity for it
+// or the context is done. In the latter case, the error wraps both ErrQueueFull and the
+// context's error.
+func (p *WorkerPool) EnqueueWait(ctx context.Context, t Job) error {
+	for {
+		var space <-chan struct{}
+		if n, ok := p.queue.(spaceNotifier); ok {
+			space = n.space()
+		}
+		err := p.Enqueue(t)
+		if !errors.Is(err, ErrQueueFull) {
+			return err
+		}
+
+		var poll <-chan time.Time
+		if space == nil {
+			// The queue cannot tell when it has room, check it again later.
+			poll = time.After(enqueuePollInterval)
+		}
+		select {
+		case <-space:
+		case <-poll:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrQueueFull, ctx.Err())
+		}
+	}
+}
+
+// EnqueueTimeout pushes a task to the queue, blocking until the queue has capacity for it
+// or the timeout expires.
+func (p *WorkerPool) EnqueueTimeout(t Job, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return p.EnqueueWait(ctx, t)
+}
+
+// QueueDepth returns the number of jobs waiting in the queue at each priority. Queues
+// without priorities report all their jobs at priority zero.
+func (p *WorkerPool) QueueDepth() map[int]int {
+	if d, ok := p.queue.(depther); ok {
+		return d.Depth()
+	}
+	return map[int]int{0: p.queue.Len()}
+}
+
+// Cancel cancels the enqueued or running job with the given id, returns false if there's no such job.
+func (p *WorkerPool) Cancel(id string) bool {
+	v, ok := p.jobs.Load(id)
+	if !ok {
 		return false
 	}
+	j, ok := v.(Job)
+	if !ok {
+		return false
+	}
+	j.Cancel()
+	return true
 }
 
-// Start starts the worker pool pattern.
-func (p WorkerPool) Start(ctx context.Context) {
-	for _ = range p.workers {
-		p.wg.Add(1)
-		go func() {
-			defer p.wg.Done()
-			for {
-				select {
-				case j, ok := <-p.queue:
-					if !ok {
-						return
-					}
-					go func() {
-						err := j.Write()
-						if err != nil {
-							log.Printf("error writing the result of task %s: %v", j.ID(), err)
-						}
-					}()
-					j.Exec(ctx)
-				case <-ctx.Done():
-					return
+// Use registers middleware wrapping every attempt of every task of the pool, outside the tasks' own middleware.
+func (p *WorkerPool) Use(middleware ...Middleware) {
+	p.middleware.use(middleware...)
+}
+
+// OnStart registers a hook that runs when any job of the pool starts executing.
+func (p *WorkerPool) OnStart(fn func(Job)) {
+	p.hooks.mu.Lock()
+	defer p.hooks.mu.Unlock()
+	p.hooks.onStart = append(p.hooks.onStart, fn)
+}
+
+// OnRetry registers a hook that runs before any task of the pool is retried.
+func (p *WorkerPool) OnRetry(fn func(j Job, attempt int, err error)) {
+	p.hooks.mu.Lock()
+	defer p.hooks.mu.Unlock()
+	p.hooks.onRetry = append(p.hooks.onRetry, fn)
+}
+
+// OnSuccess registers a hook that runs when any job of the pool succeeds.
+func (p *WorkerPool) OnSuccess(fn func(Job, Result[any])) {
+	p.hooks.mu.Lock()
+	defer p.hooks.mu.Unlock()
+	p.hooks.onSuccess = append(p.hooks.onSuccess, fn)
+}
+
+// OnFailure registers a hook that runs when any job of the pool fails, times out or is cancelled.
+func (p *WorkerPool) OnFailure(fn func(Job, Result[any])) {
+	p.hooks.mu.Lock()
+	defer p.hooks.mu.Unlock()
+	p.hooks.onFailure = append(p.hooks.onFailure, fn)
+}
+
+// OnComplete registers a hook that runs when any job of the pool finishes, whatever its outcome.
+func (p *WorkerPool) OnComplete(fn func(Job, Result[any])) {
+	p.hooks.mu.Lock()
+	defer p.hooks.mu.Unlock()
+	p.hooks.onComplete = append(p.hooks.onComplete, fn)
+}
+
+// Start starts the worker pool pattern. It returns ErrPoolAlreadyStarted if the pool
+// is already running and ErrPoolStopped if it has been stopped.
+func (p *WorkerPool) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.state {
+	case PoolStateRunning:
+		return ErrPoolAlreadyStarted
+	case PoolStateDraining, PoolStateStopped:
+		return ErrPoolStopped
+	}
+	p.state = PoolStateRunning
+	p.ctx, p.cancel = context.WithCancelCause(ctx)
+
+	for range p.workers {
+		p.spawn()
+	}
+	return nil
+}
+
+// Size returns the number of workers of the pool.
+func (p *WorkerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.workers
+}
+
+// Resize grows or shrinks the pool to n workers. Retired workers finish their current
+// job first. It returns ErrPoolStopped if the pool is stopping or stopped.
+func (p *WorkerPool) Resize(n int) error {
+	if n < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidPoolSize, n)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.state {
+	case PoolStateDraining, PoolStateStopped:
+		return ErrPoolStopped
+	case PoolStateCreated:
+		p.workers = n
+		return nil
+	}
+	for p.workers < n {
+		p.spawn()
+		p.workers++
+	}
+	for p.workers > n {
+		last := len(p.retirees) - 1
+		p.retirees[last]()
+		p.retirees = p.retirees[:last]
+		p.workers--
+	}
+	return nil
+}
+
+// spawn starts a new worker, must be called with the lock held on a running pool.
+func (p *WorkerPool) spawn() {
+	ctx := p.ctx
+	// Retiring a worker only stops it from popping jobs, its current job keeps the pool's context.
+	popCtx, retire := context.WithCancel(ctx)
+	p.retirees = append(p.retirees, retire)
+	p.lastID++
+	workerID := p.lastID
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer retire()
+		for {
+			// Pop returns a waiting job even if the context is done, so a retired worker
+			// would keep popping jobs as long as the queue has some.
+			if popCtx.Err() != nil {
+				return
+			}
+			j, err := p.queue.Pop(popCtx)
+			if err != nil {
+				return
+			}
+			// Jobs replayed by a durable queue were never enqueued through the pool.
+			p.jobs.LoadOrStore(j.ID(), j)
+			if p.discard.Load() {
+				p.abandon(j)
+				continue
+			}
+			p.observe(j)
+			p.busy.Add(1)
+			if err := p.queue.Start(j); err != nil {
+				log.Printf("error recording the start of task %s: %v", j.ID(), err)
+			}
+			p.wg.Add(1)
+			go func() {
+				defer p.wg.Done()
+				err := j.Write()
+				if err != nil {
+					log.Printf("error writing the result of task %s: %v", j.ID(), err)
 				}
+			}()
+			env := &execEnv{
+				job:        j,
+				workerID:   workerID,
+				hooks:      p.hooks,
+				middleware: p.middleware.snapshot(),
+			}
+			p.exec(ctx, env)
+			p.busy.Add(-1)
+			// A job cut short by a forced shutdown is given back to the queue.
+			if p.forced.Load() && cutShort(j, env) {
+				p.abandon(j)
+				continue
+			}
+			p.jobs.CompareAndDelete(j.ID(), j)
+			if err := p.queue.Ack(j); err != nil {
+				log.Printf("error acknowledging task %s: %v", j.ID(), err)
 			}
+		}
+	}()
+}
+
+// observe records how long the job waited in the queue, for the autoscaler.
+func (p *WorkerPool) observe(j Job) {
+	if enqueuedAt := j.Metadata().EnqueuedAt; !enqueuedAt.IsZero() {
+		p.waitSum.Add(int64(time.Since(enqueuedAt)))
+		p.waitCount.Add(1)
+	}
+}
+
+// exec executes the job of the environment, recovering from any panic that escaped it so that the worker survives.
+func (p *WorkerPool) exec(ctx context.Context, env *execEnv) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("recovered from panic executing task %s: %v\n%s", env.job.ID(), r, debug.Stack())
+		}
+	}()
+	env.job.Exec(withExecEnv(ctx, env))
+}
+
+// cutShort reports whether the job failed because the pool stopped, rather than on its own
+// or because it was cancelled. Jobs that do not report their outcome are judged by their status.
+func cutShort(j Job, env *execEnv) bool {
+	if env.completed {
+		return errors.Is(env.err, ErrPoolStopped)
+	}
+	return j.Metadata().Status != TaskStatusSuccess
+}
+
+// abandon records a popped job that did not complete and gives it back to the queue.
+func (p *WorkerPool) abandon(j Job) {
+	p.jobs.CompareAndDelete(j.ID(), j)
+	if r, ok := p.queue.(releaser); ok {
+		if err := r.release(j); err != nil {
+			log.Printf("error releasing task %s: %v", j.ID(), err)
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unfinished = append(p.unfinished, j.ID())
+}
+
+// Stop closes the queue and the worker pool gracefully, waiting for the queued jobs
+// to run. It is safe to call more than once, later calls wait for the first to finish.
+func (p *WorkerPool) Stop() {
+	p.shutdown(context.Background(), true)
+}
+
+// Shutdown stops the worker pool from accepting jobs and waits for the running and
+// queued jobs to finish. Once the context is done, the running jobs are cancelled and
+// the queued ones are left unexecuted. It returns the sorted ids of the jobs that did
+// not complete, along with the context's error if it expired first. In that case it
+// does not wait for the cancelled jobs to return, Done is closed once they have. The
+// tasks cancelled this way fail with an error wrapping ErrPoolStopped.
+// Jobs of a durable queue that did not complete are replayed the next time the queue is opened.
+func (p *WorkerPool) Shutdown(ctx context.Context) ([]string, error) {
+	return p.shutdown(ctx, true)
+}
+
+// ShutdownNow is like Shutdown, but it only waits for the running jobs and leaves the queued ones unexecuted.
+func (p *WorkerPool) ShutdownNow(ctx context.Context) ([]string, error) {
+	return p.shutdown(ctx, false)
+}
+
+func (p *WorkerPool) shutdown(ctx context.Context, drain bool) ([]string, error) {
+	p.mu.Lock()
+	if p.state == PoolStateDraining || p.state == PoolStateStopped {
+		p.mu.Unlock()
+		// Another call is shutting the pool down, wait for it.
+		select {
+		case <-p.done:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	p.state = PoolStateDraining
+	cancel := p.cancel
+	p.mu.Unlock()
+	if cancel == nil {
+		// The pool was never started.
+		cancel = func(error) {}
+	}
+
+	if !drain {
+		p.discard.Store(true)
+	}
+	if err := p.queue.Close(); err != nil {
+		log.Printf("error closing the queue: %v", err)
+	}
+
+	// Wait for the workers to run their last tasks and for their results to be written.
+	waited := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(waited)
+	}()
+	var err error
+	select {
+	case <-waited:
+	case <-ctx.Done():
+		err = ctx.Err()
+		p.discard.Store(true)
+		p.forced.Store(true)
+		// Don't wait past the deadline for the cancelled jobs to return, their
+		// task funcs may ignore the context. Done is closed once they do.
+	}
+	// The jobs cut short tell by their error that the pool stopped.
+	cancel(ErrPoolStopped)
+
+	// Collect the jobs no worker popped, the closed queue returns them without blocking.
+	popCtx, popCancel := context.WithCancel(context.Background())
+	popCancel()
+	for {
+		j, popErr := p.queue.Pop(popCtx)
+		if popErr != nil {
+			break
+		}
+		p.abandon(j)
+	}
+
+	unfinished := p.unfinishedIDs(err != nil)
+	p.mu.Lock()
+	p.state = PoolStateStopped
+	p.mu.Unlock()
+	if err != nil {
+		go func() {
+			<-waited
+			close(p.done)
 		}()
+	} else {
+		close(p.done)
 	}
+	return unfinished, err
 }
 
-// Stop closes the queue and the worker pool gracefully.
-func (p WorkerPool) Stop() {
-	close(p.queue)
-	// Wait for the workers to run their last tasks.
-	p.wg.Wait()
+// unfinishedIDs returns the sorted ids of the jobs that did not complete, including
+// the ones still running if the shutdown was forced.
+func (p *WorkerPool) unfinishedIDs(forced bool) []string {
+	var ids []string
+	if forced {
+		// Read the running jobs first, a job abandoned meanwhile is then found in both.
+		p.jobs.Range(func(id, _ any) bool {
+			ids = append(ids, id.(string))
+			return true
+		})
+	}
+	p.mu.Lock()
+	ids = append(ids, p.unfinished...)
+	p.mu.Unlock()
+	slices.Sort(ids)
+	return slices.Compact(ids)
 }
@@ -2,7 +2,10 @@ package iocast
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestWorkerPool(t *testing.T) {
@@ -39,14 +42,14 @@ func TestWorkerPool(t *testing.T) {
 	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if i == 0 {
-				ok := tt.p.Enqueue(task)
-				if !ok {
-					t.Errorf("unexpected full queue")
+				err := tt.p.Enqueue(task)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
 				}
 			} else {
-				ok := tt.p.Enqueue(task2)
-				if ok {
-					t.Errorf("unexpected not full queue")
+				err := tt.p.Enqueue(task2)
+				if !errors.Is(err, ErrQueueFull) {
+					t.Errorf("unexpected error: got %v want %v", err, ErrQueueFull)
 				}
 			}
 
@@ -59,3 +62,419 @@ func TestWorkerPool(t *testing.T) {
 		})
 	}
 }
+
+type panickingJob struct{}
+
+func (panickingJob) ID() string           { return "panicking" }
+func (panickingJob) Exec(context.Context) { panic("bad job") }
+func (panickingJob) Cancel()              {}
+func (panickingJob) Write() error         { return nil }
+func (panickingJob) Metadata() Metadata   { return Metadata{} }
+
+func TestWorkerPoolPanic(t *testing.T) {
+	p := NewWorkerPool(1, 2)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	task := TaskBuilder("ok", taskFn).Build()
+	p.Enqueue(panickingJob{})
+	p.Enqueue(task)
+
+	result := <-task.Wait()
+	if result.Out != "args" {
+		t.Errorf("unexpected result out: got %v want %v", result.Out, "args")
+	}
+}
+
+func TestWorkerPoolMetadata(t *testing.T) {
+	p := NewWorkerPool(1, 1)
+
+	db := NewMemDB(&sync.Map{})
+	taskFn := NewTaskFunc(context.Background(), "args", testTaskFn)
+	task := TaskBuilder("uuid", taskFn).Database(db).Build()
+	p.Enqueue(task)
+	p.Start(context.Background())
+	<-task.Wait()
+	p.Stop()
+
+	metadata := task.Metadata()
+	if metadata.EnqueuedAt.IsZero() || metadata.EnqueuedAt.After(metadata.StartedAt) {
+		t.Errorf("unexpected enqueue time: got %v, started at %v", metadata.EnqueuedAt, metadata.StartedAt)
+	}
+	if metadata.QueueWait <= 0 {
+		t.Errorf("unexpected queue wait: got %v", metadata.QueueWait)
+	}
+	if metadata.WorkerID != 1 {
+		t.Errorf("unexpected worker id: got %v want %v", metadata.WorkerID, 1)
+	}
+
+	// the result is written asynchronously
+	var stored Result[string]
+	var err error
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if stored, err = ReadResult[string](db, "uuid"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("result was not written: %v", err)
+	}
+	if stored.Metadata.WorkerID != 1 || len(stored.Metadata.Attempts) != 1 {
+		t.Errorf("unexpected stored metadata: got %+v", stored.Metadata)
+	}
+}
+
+// testOpaqueQueue hides whether the queue it wraps has room.
+type testOpaqueQueue struct {
+	Queue
+}
+
+func TestWorkerPoolEnqueueWait(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue func() Queue
+	}{
+		{"queue signals room", func() Queue { return NewMemQueue(1) }},
+		{"queue is polled", func() Queue { return testOpaqueQueue{NewMemQueue(1)} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewWorkerPoolWithQueue(1, tt.queue())
+
+			release := make(chan struct{})
+			blocking := func(_ context.Context, args string) (string, error) {
+				<-release
+				return args, nil
+			}
+			first := TaskBuilder("first", NewTaskFunc(context.Background(), "first", blocking)).Build()
+			second := TaskBuilder("second", NewTaskFunc(context.Background(), "second", testTaskFn)).Build()
+			third := TaskBuilder("third", NewTaskFunc(context.Background(), "third", testTaskFn)).Build()
+
+			if err := p.Enqueue(first); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := p.Enqueue(second); !errors.Is(err, ErrQueueFull) {
+				t.Fatalf("unexpected error: got %v want %v", err, ErrQueueFull)
+			}
+			err := p.EnqueueTimeout(second, 20*time.Millisecond)
+			if !errors.Is(err, ErrQueueFull) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("unexpected error: got %v want %v", err, ErrQueueFull)
+			}
+
+			// the first task is popped by the worker and blocks it, which makes room for the second
+			p.Start(context.Background())
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := p.EnqueueWait(ctx, second); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// the third one waits until the second one is popped
+			done := make(chan error, 1)
+			go func() {
+				done <- p.EnqueueWait(ctx, third)
+			}()
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result := <-third.Wait(); result.Out != "third" {
+				t.Errorf("unexpected result out: got %v want %v", result.Out, "third")
+			}
+
+			p.Stop()
+			if err := p.EnqueueWait(ctx, TaskBuilder("late", NewTaskFunc(context.Background(), "late", testTaskFn)).Build()); !errors.Is(err, ErrPoolStopped) {
+				t.Errorf("unexpected error: got %v want %v", err, ErrPoolStopped)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolLifecycle(t *testing.T) {
+	p := NewWorkerPool(2, 2)
+	if state := p.State(); state != PoolStateCreated {
+		t.Errorf("unexpected state: got %v want %v", state, PoolStateCreated)
+	}
+
+	release := make(chan struct{})
+	blocking := func(_ context.Context, args string) (string, error) {
+		<-release
+		return args, nil
+	}
+	task := TaskBuilder("blocking", NewTaskFunc(context.Background(), "args", blocking)).Build()
+	if err := p.Enqueue(task); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.Start(context.Background()); !errors.Is(err, ErrPoolAlreadyStarted) {
+		t.Errorf("unexpected error: got %v want %v", err, ErrPoolAlreadyStarted)
+	}
+	if state := p.State(); state != PoolStateRunning {
+		t.Errorf("unexpected state: got %v want %v", state, PoolStateRunning)
+	}
+
+	// concurrent calls to Stop all wait for the running task
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Stop()
+		}()
+	}
+	for p.State() != PoolStateDraining {
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Enqueue(TaskBuilder("late", NewTaskFunc(context.Background(), "late", testTaskFn)).Build()); !errors.Is(err, ErrPoolStopped) {
+		t.Errorf("unexpected error: got %v want %v", err, ErrPoolStopped)
+	}
+	select {
+	case <-p.Done():
+		t.Fatal("pool is done while a task is still running")
+	default:
+	}
+
+	close(release)
+	wg.Wait()
+	select {
+	case <-p.Done():
+	default:
+		t.Fatal("pool is not done after Stop returned")
+	}
+	if state := p.State(); state != PoolStateStopped {
+		t.Errorf("unexpected state: got %v want %v", state, PoolStateStopped)
+	}
+	if result := <-task.Wait(); result.Out != "args" {
+		t.Errorf("unexpected result out: got %v want %v", result.Out, "args")
+	}
+
+	p.Stop()
+	if err := p.Start(context.Background()); !errors.Is(err, ErrPoolStopped) {
+		t.Errorf("unexpected error: got %v want %v", err, ErrPoolStopped)
+	}
+}
+
+func TestWorkerPoolShutdown(t *testing.T) {
+	tests := []struct {
+		name       string
+		now        bool
+		release    bool
+		timeout    time.Duration
+		unfinished []string
+		err        error
+	}{
+		{"drain", false, true, time.Second, nil, nil},
+		{"now", true, true, time.Second, []string{"queued1", "queued2"}, nil},
+		{"expired", false, false, 50 * time.Millisecond, []string{"queued1", "queued2", "running"}, context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewWorkerPool(1, 2)
+			p.Start(context.Background())
+
+			release := make(chan struct{})
+			defer close(release)
+			blocking := func(ctx context.Context, args string) (string, error) {
+				select {
+				case <-release:
+					return args, nil
+				case <-ctx.Done():
+					return "", ctx.Err()
+				}
+			}
+			running := TaskBuilder("running", NewTaskFunc(context.Background(), "running", blocking)).Build()
+			if err := p.Enqueue(running); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for running.Metadata().Status != TaskStatusRunning {
+				time.Sleep(time.Millisecond)
+			}
+			queued := []*Task[string]{
+				TaskBuilder("queued1", NewTaskFunc(context.Background(), "queued1", testTaskFn)).Build(),
+				TaskBuilder("queued2", NewTaskFunc(context.Background(), "queued2", testTaskFn)).Build(),
+			}
+			for _, task := range queued {
+				if err := p.Enqueue(task); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if tt.release {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					release <- struct{}{}
+				}()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			var unfinished []string
+			var err error
+			if tt.now {
+				unfinished, err = p.ShutdownNow(ctx)
+			} else {
+				unfinished, err = p.Shutdown(ctx)
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unexpected error: got %v want %v", err, tt.err)
+			}
+			if len(unfinished) != len(tt.unfinished) {
+				t.Fatalf("unexpected unfinished jobs: got %v want %v", unfinished, tt.unfinished)
+			}
+			for i := range unfinished {
+				if unfinished[i] != tt.unfinished[i] {
+					t.Errorf("unexpected unfinished jobs: got %v want %v", unfinished, tt.unfinished)
+				}
+			}
+			if state := p.State(); state != PoolStateStopped {
+				t.Errorf("unexpected state: got %v want %v", state, PoolStateStopped)
+			}
+			if tt.release {
+				if result := <-running.Wait(); result.Out != "running" {
+					t.Errorf("unexpected result out: got %v want %v", result.Out, "running")
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	p := NewWorkerPool(1, 3)
+	if err := p.Resize(-1); !errors.Is(err, ErrInvalidPoolSize) {
+		t.Errorf("unexpected error: got %v want %v", err, ErrInvalidPoolSize)
+	}
+	p.Start(context.Background())
+
+	release := make(chan struct{})
+	hold := make(chan struct{})
+	blocking := func(ch chan struct{}) func(context.Context, string) (string, error) {
+		return func(_ context.Context, args string) (string, error) {
+			<-ch
+			return args, nil
+		}
+	}
+	enqueue := func(ch chan struct{}, ids ...string) []*Task[string] {
+		var tasks []*Task[string]
+		for _, id := range ids {
+			task := TaskBuilder(id, NewTaskFunc(context.Background(), id, blocking(ch))).Build()
+			if err := p.Enqueue(task); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tasks = append(tasks, task)
+		}
+		return tasks
+	}
+	running := func(tasks []*Task[string]) int {
+		n := 0
+		for _, task := range tasks {
+			if task.Metadata().Status == TaskStatusRunning {
+				n++
+			}
+		}
+		return n
+	}
+	waitRunning := func(tasks []*Task[string], expected int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for running(tasks) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("unexpected number of running tasks: got %v want %v", running(tasks), expected)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// the new workers pick up the queued tasks
+	tasks := enqueue(release, "first", "second", "third")
+	if err := p.Resize(3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitRunning(tasks, 3)
+
+	// the retired workers finish their current task but don't pop the queued ones
+	if err := p.Resize(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size := p.Size(); size != 1 {
+		t.Errorf("unexpected size: got %v want %v", size, 1)
+	}
+	queued := enqueue(hold, "fourth", "fifth")
+	for range tasks {
+		release <- struct{}{}
+	}
+	for _, task := range tasks {
+		if result := <-task.Wait(); result.Err != nil {
+			t.Errorf("unexpected error: %v", result.Err)
+		}
+	}
+
+	// a single worker is left
+	waitRunning(queued, 1)
+	time.Sleep(20 * time.Millisecond)
+	if n := running(queued); n != 1 {
+		t.Errorf("unexpected number of running tasks: got %v want %v", n, 1)
+	}
+	close(hold)
+
+	p.Stop()
+	if err := p.Resize(2); !errors.Is(err, ErrPoolStopped) {
+		t.Errorf("unexpected error: got %v want %v", err, ErrPoolStopped)
+	}
+}
+
+// hangingJob never returns from Exec until it is released.
+type hangingJob struct {
+	release chan struct{}
+}
+
+func (hangingJob) ID() string             { return "hanging" }
+func (j hangingJob) Exec(context.Context) { <-j.release }
+func (hangingJob) Cancel()                {}
+func (hangingJob) Write() error           { return nil }
+func (hangingJob) Metadata() Metadata     { return Metadata{} }
+
+func TestWorkerPoolShutdownHangingJob(t *testing.T) {
+	p := NewWorkerPool(1, 1)
+	p.Start(context.Background())
+
+	j := hangingJob{release: make(chan struct{})}
+	if err := p.Enqueue(j); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for p.queue.Len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	unfinished, err := p.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: got %v want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Shutdown returned long after its deadline: %v", elapsed)
+	}
+	if len(unfinished) != 1 || unfinished[0] != "hanging" {
+		t.Errorf("unexpected unfinished jobs: got %v want %v", unfinished, []string{"hanging"})
+	}
+
+	// the pool stops once the job returns
+	select {
+	case <-p.Done():
+		t.Fatal("pool is done while a job is still running")
+	default:
+	}
+	close(j.release)
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("pool is not done after the job returned")
+	}
+}